@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	githubanalysis "github.com/benfred/github-analysis"
+	"github.com/benfred/github-analysis/config"
+	"github.com/benfred/github-analysis/githubarchive"
+)
+
+// observeDay adds the activity from a parsed_events.tsv file to the classifier
+func observeDay(filename string, day time.Time, classifier *githubarchive.BotClassifier) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 10 {
+			// the activity checks need the UTC time column, older files only have the
+			// day so only count the events
+			if len(fields) >= 6 {
+				classifier.Observe(fields[5], day)
+			}
+			continue
+		}
+
+		at, err := time.Parse(time.RFC3339, fields[9])
+		if err != nil {
+			at = day
+		}
+		classifier.Observe(fields[5], at)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("Failed to read '%s': %s", filename, err.Error())
+	}
+	return nil
+}
+
+func main() {
+	pathname := flag.String("path", "", "Githubarchive directory containing the parsed_events.tsv files")
+	layoutName := flag.String("layout", config.ReadIfExists("config.toml").GithubarchiveLayout,
+		"Layout of the githubarchive files: nested or flat, defaults to githubarchivelayout in config.toml")
+	overrides := flag.String("overrides", "", "File of 'allow <login>' and 'deny <login>' lines, defaults to bot_overrides.txt in -path")
+	useDB := flag.Bool("db", false, "Also flag the scraped users that github reports as bots")
+	maxEvents := flag.Int("max-events", 2000, "Flag accounts with more than this many events in a single day")
+	maxHours := flag.Int("max-hours", 23, "Flag accounts active in at least this many hours of a single day")
+	flag.Parse()
+
+	if len(*pathname) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	layout, err := githubarchive.ParseLayout(*layoutName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// try to cleanup gracefully on system interrupts
+	ctx, cancel := context.WithCancel(context.Background())
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-c
+		cancel()
+	}()
+
+	classifier := githubarchive.NewBotClassifier()
+	classifier.MaxEventsPerDay = *maxEvents
+	classifier.MaxActiveHours = *maxHours
+
+	if *overrides == "" {
+		*overrides = path.Join(*pathname, "bot_overrides.txt")
+	}
+	if err := classifier.LoadOverrides(*overrides); err != nil {
+		log.Fatal(err)
+	}
+
+	if *useDB {
+		db, err := githubanalysis.Connect(config.Read("config.toml"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		logins, err := db.BotLogins()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, login := range logins {
+			classifier.UserTypes[strings.ToLower(login)] = true
+		}
+		db.Close()
+	}
+
+	days, err := githubarchive.FindDays(ctx, *pathname, layout)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(days) == 0 {
+		log.Fatalf("No githubarchive files found in '%s' with the %s layout", *pathname, layout.Name())
+	}
+	for _, day := range days {
+		if ctx.Err() != nil {
+			log.Fatal(ctx.Err())
+		}
+
+		filename := path.Join(*pathname, layout.DayFilePath(day, "parsed_events.tsv"))
+		if _, err := os.Stat(filename); os.IsNotExist(err) {
+			fmt.Printf("Skipping '%s' - not parsed yet\n", filename)
+			continue
+		}
+		if err := observeDay(filename, day, classifier); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	bots := classifier.Bots()
+	logins := make([]string, 0, len(bots))
+	for login := range bots {
+		logins = append(logins, login)
+	}
+	sort.Strings(logins)
+
+	outputfilename := path.Join(*pathname, "bots.tsv")
+	output, err := os.Create(outputfilename)
+	if err != nil {
+		log.Fatalf("Failed to open file '%s' for writing: %s", outputfilename, err.Error())
+	}
+	for _, login := range logins {
+		fmt.Fprintf(output, "%s\t%s\n", login, bots[login])
+	}
+	if err := output.Close(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Wrote '%s' - %d bots\n", outputfilename, len(logins))
+}
@@ -1,11 +1,226 @@
 package main
 
 import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
 	"github.com/benfred/github-analysis/config"
 	"github.com/benfred/github-analysis/githubarchive"
 )
 
+func usage(flags *flag.FlagSet) func() {
+	return func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [download|verify|gaps|migrate] [flags]\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+}
+
+// parseTime parses a date like 2018-01-02 or an hour like 2018-01-02-15. When roundUp
+// is set, dates are extended to include every hour of the day
+func parseTime(value string, roundUp bool) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02-15", value); err == nil {
+		if roundUp {
+			t = t.Add(time.Hour)
+		}
+		return t, nil
+	}
+
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return t, fmt.Errorf("Failed to parse '%s': expected a date like 2018-01-02 or 2018-01-02-15", value)
+	}
+	if roundUp {
+		t = t.AddDate(0, 0, 1)
+	}
+	return t, nil
+}
+
 func main() {
+	// the first argument optionally selects the command to run
+	command := "download"
+	args := os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command = args[0]
+		args = args[1:]
+	}
+
+	flags := flag.NewFlagSet(command, flag.ExitOnError)
+	flags.Usage = usage(flags)
+	workers := flags.Int("workers", 4, "Number of files to download in parallel")
+	retries := flags.Int("retries", 3, "Number of times to retry a failed download")
+	action := flags.String("action", "report", "What to do with corrupt files when verifying: report, quarantine or redownload")
+	from := flags.String("from", "", "First date (or hour) to download or check, defaults to the start of the githubarchive")
+	to := flags.String("to", "", "Last date (or hour) to download or check, defaults to yesterday")
+	sinceLast := flags.Bool("since-last", false, "Start from the oldest hour that's missing on disk, rather than the start of the range")
+	dryrun := flags.Bool("dryrun", false, "Print out what would be downloaded, without downloading anything")
+	format := flags.String("format", "text", "Output format for the gap report: text or json")
+	progress := flags.String("progress", "line", "How to report download progress: line, json or none")
+	newLayout := flags.String("new-layout", "", "Layout to convert the files to when migrating: nested or flat")
+	minSize := flags.Int64("min-size", 1024, "Files smaller than this many bytes are reported as undersized in the gap report")
+	flags.Parse(args)
+
 	cfg := config.Read("config.toml")
-	githubarchive.DownloadFiles(cfg.GithubarchivePath)
+
+	// try to cleanup gracefully on system interrupts
+	ctx, cancel := context.WithCancel(context.Background())
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-c
+		cancel()
+	}()
+
+	layout, err := githubarchive.ParseLayout(cfg.GithubarchiveLayout)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	downloader := githubarchive.NewDownloader(cfg.GithubarchivePath)
+	downloader.Layout = layout
+	if cfg.GithubarchiveMirror != "" {
+		source := githubarchive.NewDirSource(cfg.GithubarchiveMirror)
+		if cfg.GithubarchiveMirrorLayout != "" {
+			if source.Layout, err = githubarchive.ParseLayout(cfg.GithubarchiveMirrorLayout); err != nil {
+				log.Fatal(err)
+			}
+		}
+		downloader.Source = source
+	} else {
+		source := githubarchive.NewHTTPSource(cfg.GithubarchiveURL)
+		if cfg.Download.UserAgent != "" {
+			source.UserAgent = cfg.Download.UserAgent
+		}
+		if cfg.Download.TimeoutMinutes > 0 {
+			source.Client = githubarchive.NewHTTPClient(time.Duration(cfg.Download.TimeoutMinutes) * time.Minute)
+		}
+		source.Limiter = githubarchive.NewRateLimiter(cfg.Download.BytesPerSecond)
+		downloader.Source = source
+	}
+	downloader.RefreshWindow = time.Duration(cfg.Download.RefreshHours) * time.Hour
+	downloader.Workers = *workers
+	downloader.Retries = *retries
+	downloader.DryRun = *dryrun
+	switch *progress {
+	case "line":
+		downloader.Progress = lineProgress
+	case "json":
+		downloader.Progress = jsonProgress
+	case "none":
+	default:
+		log.Fatalf("Unknown progress format '%s'", *progress)
+	}
+
+	// keep stdout as pure json lines when the progress is being parsed by another program
+	output := os.Stdout
+	if *progress == "json" {
+		output = os.Stderr
+	}
+
+	outages, err := githubarchive.LoadOutageCalendar(path.Join(cfg.GithubarchivePath, githubarchive.OutageFilename))
+	if err != nil {
+		log.Fatal(err)
+	}
+	downloader.Outages = outages
+
+	start := githubarchive.ArchiveStart
+	if *from != "" {
+		var err error
+		if start, err = parseTime(*from, false); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// only go up to the end of yesterday by default, since today is still being written
+	now := time.Now().UTC()
+	end := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	if *to != "" {
+		var err error
+		if end, err = parseTime(*to, true); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	switch command {
+	case "download":
+		if *sinceLast {
+			// resume from the oldest missing hour rather than the newest file on disk, since
+			// hours are downloaded newest first and a failed run can leave holes behind
+			if start, err = githubarchive.FirstMissingHour(cfg.GithubarchivePath, layout, start, end, outages); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		fmt.Fprintf(output, "Downloading from %s to %s\n", start.Format(time.RFC3339), end.Format(time.RFC3339))
+		summary := downloader.DownloadContext(ctx, start, end)
+		summary.Print(output)
+		if !*dryrun {
+			if err := outages.Save(); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if summary.Err() != nil || ctx.Err() != nil {
+			os.Exit(1)
+		}
+
+	case "verify":
+		verifyAction, err := githubarchive.ParseVerifyAction(*action)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		summary, err := downloader.VerifyContext(ctx, verifyAction)
+		if summary != nil {
+			summary.Print(os.Stdout)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if (len(summary.Corrupt) > 0 && verifyAction == githubarchive.VerifyReport) || summary.Err() != nil {
+			os.Exit(1)
+		}
+
+	case "gaps":
+		report, err := githubarchive.FindGaps(cfg.GithubarchivePath, layout, start, end, *minSize, outages)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if *format == "json" {
+			if err := report.WriteJSON(os.Stdout); err != nil {
+				log.Fatal(err)
+			}
+		} else {
+			report.Print(os.Stdout)
+		}
+		if report.HasGaps() {
+			os.Exit(1)
+		}
+
+	case "migrate":
+		to, err := githubarchive.ParseLayout(*newLayout)
+		if err != nil || *newLayout == "" {
+			log.Fatalf("Expected -new-layout to be one of nested or flat")
+		}
+
+		moved, err := githubarchive.MigrateLayout(ctx, cfg.GithubarchivePath, layout, to, *dryrun)
+		fmt.Printf("Moved %d hours from the %s layout to the %s layout\n", moved, layout.Name(), to.Name())
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !*dryrun {
+			fmt.Printf("Set githubarchivelayout = \"%s\" in config.toml to use the new layout\n", to.Name())
+		}
+
+	default:
+		flags.Usage()
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/benfred/github-analysis/githubarchive"
+)
+
+// formatBytes returns a human readable version of a byte count
+func formatBytes(bytes float64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	unit := 0
+	for bytes >= 1024 && unit < len(units)-1 {
+		bytes /= 1024
+		unit++
+	}
+	return fmt.Sprintf("%.1f %s", bytes, units[unit])
+}
+
+// lineProgress renders download progress as a single updating line on stderr, with
+// errors printed out on their own lines
+func lineProgress(progress githubarchive.DownloadProgress) {
+	if progress.Err != nil {
+		fmt.Fprintf(os.Stderr, "\r\033[K%s %s: %s\n", progress.Status,
+			progress.Hour.Format("2006-01-02-15"), progress.Err.Error())
+	}
+
+	percent := 0.0
+	if progress.Total > 0 {
+		percent = 100 * float64(progress.Done) / float64(progress.Total)
+	}
+	fmt.Fprintf(os.Stderr, "\r\033[K%d/%d hours (%.1f%%), %s at %s/s, ETA %s",
+		progress.Done, progress.Total, percent, formatBytes(float64(progress.Bytes)),
+		formatBytes(progress.Rate), progress.ETA.Truncate(time.Second))
+	if progress.Done == progress.Total {
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+// jsonProgress writes out each progress event as a line of JSON on stdout
+func jsonProgress(progress githubarchive.DownloadProgress) {
+	entry := struct {
+		Hour           string  `json:"hour"`
+		Status         string  `json:"status"`
+		Error          string  `json:"error,omitempty"`
+		Done           int     `json:"done"`
+		Total          int     `json:"total"`
+		Bytes          int64   `json:"bytes"`
+		ElapsedSeconds float64 `json:"elapsed_seconds"`
+		BytesPerSecond float64 `json:"bytes_per_second"`
+		AverageRate    float64 `json:"average_bytes_per_second"`
+		ETASeconds     float64 `json:"eta_seconds"`
+	}{
+		Hour:           progress.Hour.Format(time.RFC3339),
+		Status:         progress.Status,
+		Done:           progress.Done,
+		Total:          progress.Total,
+		Bytes:          progress.Bytes,
+		ElapsedSeconds: progress.Elapsed.Seconds(),
+		BytesPerSecond: progress.Rate,
+		AverageRate:    progress.AverageRate,
+		ETASeconds:     progress.ETA.Seconds(),
+	}
+	if progress.Err != nil {
+		entry.Error = progress.Err.Error()
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to encode progress: %s\n", err.Error())
+		return
+	}
+	fmt.Println(string(line))
+}
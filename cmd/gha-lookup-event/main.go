@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path"
+	"syscall"
+	"time"
+
+	"github.com/benfred/github-analysis/config"
+	"github.com/benfred/github-analysis/githubarchive"
+)
+
+func main() {
+	hourName := flag.String("hour", "", "Hour file to read from (like 2015-01-02-15)")
+	id := flag.String("id", "", "Id of the event to print, using the sidecar index for the hour")
+	offset := flag.Int64("offset", -1, "Uncompressed byte offset of the event to print")
+	index := flag.Bool("index", false, "Build the sidecar indices for every hour from -from to -to")
+	from := flag.String("from", "", "First date to index (like 2015-01-02)")
+	to := flag.String("to", "", "Last date to index, defaults to the same day as -from")
+	flag.Parse()
+
+	cfg := config.Read("config.toml")
+	layout, err := githubarchive.ParseLayout(cfg.GithubarchiveLayout)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// try to cleanup gracefully on system interrupts
+	ctx, cancel := context.WithCancel(context.Background())
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-c
+		cancel()
+	}()
+
+	if *index {
+		start, err := time.Parse("2006-01-02", *from)
+		if err != nil {
+			log.Fatalf("Failed to parse -from '%s': %s", *from, err.Error())
+		}
+		end := start
+		if *to != "" {
+			if end, err = time.Parse("2006-01-02", *to); err != nil {
+				log.Fatalf("Failed to parse -to '%s': %s", *to, err.Error())
+			}
+		}
+
+		for hour := start; hour.Before(end.AddDate(0, 0, 1)) && ctx.Err() == nil; hour = hour.Add(time.Hour) {
+			filename := path.Join(cfg.GithubarchivePath, layout.HourPath(hour))
+			if _, err := os.Stat(filename); os.IsNotExist(err) {
+				continue
+			}
+
+			events, err := githubarchive.BuildIndex(ctx, filename)
+			if err == nil {
+				err = events.Save(filename)
+			}
+			if err != nil {
+				fmt.Printf("Failed to index '%s': %s\n", filename, err.Error())
+				continue
+			}
+			fmt.Printf("Indexed '%s' - %d events\n", filename, len(events))
+		}
+		return
+	}
+
+	if *hourName == "" || (*id == "" && *offset < 0) {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	hour, err := time.Parse("2006-01-02-15", *hourName)
+	if err != nil {
+		log.Fatalf("Failed to parse -hour '%s': %s", *hourName, err.Error())
+	}
+	filename := path.Join(cfg.GithubarchivePath, layout.HourPath(hour))
+
+	var event []byte
+	if *id != "" {
+		event, err = githubarchive.LookupEvent(ctx, filename, *id)
+	} else {
+		event, err = githubarchive.ReadEventAt(ctx, filename, *offset)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	os.Stdout.Write(event)
+}
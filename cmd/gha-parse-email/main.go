@@ -1,115 +1,140 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"os"
+	"os/signal"
 	"path"
 	"runtime"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 
+	"github.com/benfred/github-analysis/config"
 	"github.com/benfred/github-analysis/githubarchive"
-	"github.com/buger/jsonparser"
 )
 
-type commitAuthor struct {
-	email string
-	name  string
-}
-
-// ParsePushCommits returns a list of author/email if the
-func parsePushCommits(data []byte) ([]*commitAuthor, error) {
-	var authors []*commitAuthor
-
-	jsonparser.ArrayEach(data, func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
-		// TODO: error handling?
-		distinct, err := jsonparser.GetBoolean(value, "distinct")
-		author, err := jsonparser.GetString(value, "author", "name")
-		email, err := jsonparser.GetString(value, "author", "email")
-		if distinct {
-			authors = append(authors, &commitAuthor{email: email, name: author})
-		}
-	}, "payload", "commits")
-	return authors, nil
-}
-
-func analyzeDay(pathname string) error {
-	hours, err := ioutil.ReadDir(pathname)
-	if err != nil {
-		return fmt.Errorf("Failed to read '%s': %s", pathname, err.Error())
-	}
-
-	outputfilename := path.Join(pathname, "parsed_email.tsv")
-	if _, err = os.Stat(outputfilename); !os.IsNotExist(err) {
+func analyzeDay(ctx context.Context, basedir string, layout githubarchive.Layout, day time.Time, lenient bool) error {
+	outputfilename := path.Join(basedir, layout.DayFilePath(day, "parsed_email.tsv"))
+	if _, err := os.Stat(outputfilename); !os.IsNotExist(err) {
 		fmt.Printf("Skipping '%s' - already exists\n", outputfilename)
 		return nil
 	}
 
+	it, err := githubarchive.NewRangeScanner(ctx, basedir, layout, day, day.AddDate(0, 0, 1))
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	it.Lenient = lenient
+	it.Filter = &githubarchive.Filter{Types: []string{"PushEvent"}}
+
 	output, err := os.Create(outputfilename)
 	if err != nil {
 		return fmt.Errorf("Failed to open file '%s' for writing: %s", outputfilename, err.Error())
 	}
 	defer output.Close()
 
-	events := 0
-	for _, hour := range hours {
-		if !hour.IsDir() && strings.HasSuffix(hour.Name(), "json.gz") {
-			hourpath := path.Join(pathname, hour.Name())
-			it, err := githubarchive.NewScanner(hourpath)
-			if err != nil {
-				return err
-			}
-			defer it.Close()
-
-			for it.Scan() {
-				events++
-				event := it.Event()
-
-				if event.Type == "PushEvent" {
-					authors, err := parsePushCommits(it.Bytes())
-					if err == nil && len(authors) > 0 {
-						author := authors[len(authors)-1]
-						tokens := strings.Split(author.email, "@")
-						domain := tokens[len(tokens)-1]
-						fmt.Fprintf(output, "%d\t%s\t%s\t%s\t%s\n", event.UserID, event.UserName, author.name, author.email, domain)
-					}
-				}
+	events, failed := 0, 0
+	for it.Scan() {
+		events++
+		event := it.Event()
+
+		push, err := githubarchive.ParsePushEvent(it.Bytes())
+		if err != nil {
+			failed++
+			continue
+		}
+
+		// use the author of the last distinct commit in the push
+		var author *githubarchive.Commit
+		for i := range push.Commits {
+			if push.Commits[i].Distinct {
+				author = &push.Commits[i]
 			}
 		}
+		if author != nil {
+			tokens := strings.Split(author.AuthorEmail, "@")
+			domain := tokens[len(tokens)-1]
+			fmt.Fprintf(output, "%d\t%s\t%s\t%s\t%s\n", event.UserID, event.UserName, author.AuthorName, author.AuthorEmail, domain)
+		}
+	}
+
+	// don't leave a partial file behind if we were interrupted or failed to read an
+	// hour, since it would be skipped as already existing on the next run
+	if err := it.Err(); err != nil {
+		output.Close()
+		os.Remove(outputfilename)
+		return err
 	}
 
-	fmt.Printf("Finished analyzing path '%s' - %d events\n", pathname, events)
+	for _, damaged := range it.Damaged() {
+		fmt.Printf("Skipped %d lines (%d bytes) in '%s'", damaged.SkippedLines, damaged.SkippedBytes, damaged.Filename)
+		if damaged.ReadErr != nil {
+			fmt.Printf(" - stopped reading early: %s", damaged.ReadErr.Error())
+		}
+		fmt.Printf("\n")
+	}
+
+	if failed > 0 {
+		fmt.Printf("Parse warnings for '%s': push_errors=%d\n", outputfilename, failed)
+	}
+
+	fmt.Printf("Finished analyzing '%s' - %d events\n", outputfilename, events)
 	return nil
 }
 
 func main() {
-	filename := flag.String("filename", "", "Filename to process")
+	filename := flag.String("filename", "", "Day to process, like /data/githubarchive/2015/01/02 (or /data/githubarchive/2015-01-02 with the flat layout)")
 	pathname := flag.String("path", "", "path to process")
+	layoutName := flag.String("layout", config.ReadIfExists("config.toml").GithubarchiveLayout,
+		"Layout of the githubarchive files: nested or flat, defaults to githubarchivelayout in config.toml")
+	lenient := flag.Bool("lenient", false, "Skip malformed lines and truncated files instead of failing the day")
 	flag.Parse()
 
+	layout, err := githubarchive.ParseLayout(*layoutName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// try to cleanup gracefully on system interrupts
+	ctx, cancel := context.WithCancel(context.Background())
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-c
+		cancel()
+	}()
+
 	if len(*pathname) > 0 {
-		dirs, err := githubarchive.FindDayPaths(*pathname)
+		days, err := githubarchive.FindDays(ctx, *pathname, layout)
 		if err != nil {
 			log.Fatal(err)
 		}
+		if len(days) == 0 {
+			log.Fatalf("No githubarchive files found in '%s' with the %s layout", *pathname, layout.Name())
+		}
 
 		numCPUs := runtime.NumCPU()
 		runtime.GOMAXPROCS(numCPUs + 1)
 
 		var wg sync.WaitGroup
 
-		pathChan := make(chan string, 100)
+		dayChan := make(chan time.Time, 100)
 
 		worker := func() {
 			defer wg.Done()
-			for path := range pathChan {
-				err := analyzeDay(path)
-				if err != nil {
-					fmt.Printf("Failed to process '%s': %s\n", path, err.Error())
-					panic(err)
+			for day := range dayChan {
+				err := analyzeDay(ctx, *pathname, layout, day, *lenient)
+				if err == context.Canceled {
+					return
+				} else if err != nil {
+					// keep going with the other days, the failed day will be retried on the next run
+					fmt.Printf("Failed to process '%s': %s\n", day.Format("2006-01-02"), err.Error())
 				}
 			}
 		}
@@ -119,16 +144,27 @@ func main() {
 			go worker()
 		}
 
-		for _, dir := range dirs {
-			pathChan <- dir
+	Loop:
+		for _, day := range days {
+			select {
+			case <-ctx.Done():
+				break Loop
+			case dayChan <- day:
+			}
 		}
-		close(pathChan)
+		close(dayChan)
 		wg.Wait()
 
 	} else if len(*filename) > 0 {
-		err := analyzeDay(*filename)
+		basedir, day, err := githubarchive.SplitDayPath(*filename, layout)
 		if err != nil {
-			panic(err)
+			log.Fatal(err)
+		}
+
+		err = analyzeDay(ctx, basedir, layout, day, *lenient)
+		if err != nil && err != context.Canceled {
+			fmt.Printf("Failed to process '%s': %s\n", day.Format("2006-01-02"), err.Error())
+			os.Exit(1)
 		}
 	} else {
 		flag.Usage()
@@ -1,31 +1,53 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
-	"io/ioutil"
 	"log"
 	"os"
+	"os/signal"
 	"path"
 	"runtime"
+	"sort"
 	"strings"
 	"sync"
+	"syscall"
+	"time"
 
+	"github.com/benfred/github-analysis/config"
 	"github.com/benfred/github-analysis/githubarchive"
 )
 
-func analyzeDay(pathname string) error {
-	hours, err := ioutil.ReadDir(pathname)
-	if err != nil {
-		return fmt.Errorf("Failed to read '%s': %s", pathname, err.Error())
+// printWarnings prints a one line summary of the parse warnings for a day
+func printWarnings(outputfilename string, warnings map[githubarchive.ParseWarning]int) {
+	names := make([]string, 0, len(warnings))
+	for warning := range warnings {
+		names = append(names, string(warning))
+	}
+	sort.Strings(names)
+
+	summary := make([]string, 0, len(names))
+	for _, name := range names {
+		summary = append(summary, fmt.Sprintf("%s=%d", name, warnings[githubarchive.ParseWarning(name)]))
 	}
+	fmt.Printf("Parse warnings for '%s': %s\n", outputfilename, strings.Join(summary, " "))
+}
 
-	outputfilename := path.Join(pathname, "parsed_events.tsv")
-	if _, err = os.Stat(outputfilename); !os.IsNotExist(err) {
+func analyzeDay(ctx context.Context, basedir string, layout githubarchive.Layout, day time.Time, lenient bool) error {
+	outputfilename := path.Join(basedir, layout.DayFilePath(day, "parsed_events.tsv"))
+	if _, err := os.Stat(outputfilename); !os.IsNotExist(err) {
 		fmt.Printf("Skipping '%s' - already exists\n", outputfilename)
 		return nil
 	}
 
+	it, err := githubarchive.NewRangeScanner(ctx, basedir, layout, day, day.AddDate(0, 0, 1))
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	it.Lenient = lenient
+
 	output, err := os.Create(outputfilename)
 	if err != nil {
 		return fmt.Errorf("Failed to open file '%s' for writing: %s", outputfilename, err.Error())
@@ -33,70 +55,113 @@ func analyzeDay(pathname string) error {
 	defer output.Close()
 
 	events := 0
-	for _, hour := range hours {
-		if !hour.IsDir() && strings.HasSuffix(hour.Name(), "json.gz") {
-			hourpath := path.Join(pathname, hour.Name())
-			it, err := githubarchive.NewScanner(hourpath)
-			if err != nil {
-				return err
-			}
-			defer it.Close()
-
-			for it.Scan() {
-				events++
-				event := it.Event()
-
-				forkID := ""
-				forkName := ""
-				if event.Type == "ForkEvent" {
-					id, name := githubarchive.ParseForkEvent(event.RepoName, it.Bytes())
-					forkID = fmt.Sprintf("%d", id)
-					forkName = name
-				}
+	warnings := make(map[githubarchive.ParseWarning]int)
+	for it.Scan() {
+		events++
+		event, eventWarnings := githubarchive.ParseEventWarnings(it.Bytes())
+		for _, warning := range eventWarnings {
+			warnings[warning]++
+		}
 
-				fmt.Fprintf(output, "%s\t%d\t%s\t%s\t%d\t%s\t%s\t%s\t%s\n",
-					event.Type,
-					event.RepoID,
-					event.RepoName,
-					event.RepoLanguage,
-					event.UserID,
-					event.UserName,
-					forkID,
-					forkName,
-					event.CreatedAt)
-			}
+		forkID := ""
+		forkName := ""
+		if event.Type == "ForkEvent" {
+			id, name := githubarchive.ParseForkEvent(event.RepoName, it.Bytes())
+			forkID = fmt.Sprintf("%d", id)
+			forkName = name
+		}
+
+		// the canonical UTC time goes at the end, so that the column numbers used by
+		// the scripts don't change
+		createdUTC := ""
+		if !event.Time.IsZero() {
+			createdUTC = event.Time.Format(time.RFC3339)
+		}
+
+		fmt.Fprintf(output, "%s\t%d\t%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\n",
+			event.Type,
+			event.RepoID,
+			event.RepoName,
+			event.RepoLanguage,
+			event.UserID,
+			event.UserName,
+			forkID,
+			forkName,
+			event.CreatedAt,
+			createdUTC)
+	}
+
+	// don't leave a partial file behind if we were interrupted or failed to read an
+	// hour, since it would be skipped as already existing on the next run
+	if err := it.Err(); err != nil {
+		output.Close()
+		os.Remove(outputfilename)
+		return err
+	}
+
+	for _, damaged := range it.Damaged() {
+		fmt.Printf("Skipped %d lines (%d bytes) in '%s'", damaged.SkippedLines, damaged.SkippedBytes, damaged.Filename)
+		if damaged.ReadErr != nil {
+			fmt.Printf(" - stopped reading early: %s", damaged.ReadErr.Error())
 		}
+		fmt.Printf("\n")
 	}
 
-	fmt.Printf("Finished analyzing path '%s' - %d events\n", pathname, events)
+	if len(warnings) > 0 {
+		printWarnings(outputfilename, warnings)
+	}
+
+	fmt.Printf("Finished analyzing '%s' - %d events\n", outputfilename, events)
 	return nil
 }
 
 func main() {
-	filename := flag.String("filename", "", "Filename to process")
+	filename := flag.String("filename", "", "Day to process, like /data/githubarchive/2015/01/02 (or /data/githubarchive/2015-01-02 with the flat layout)")
 	pathname := flag.String("path", "", "path to process")
+	layoutName := flag.String("layout", config.ReadIfExists("config.toml").GithubarchiveLayout,
+		"Layout of the githubarchive files: nested or flat, defaults to githubarchivelayout in config.toml")
+	lenient := flag.Bool("lenient", false, "Skip malformed lines and truncated files instead of failing the day")
 	flag.Parse()
 
+	layout, err := githubarchive.ParseLayout(*layoutName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// try to cleanup gracefully on system interrupts
+	ctx, cancel := context.WithCancel(context.Background())
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-c
+		cancel()
+	}()
+
 	if len(*pathname) > 0 {
-		dirs, err := githubarchive.FindDayPaths(*pathname)
+		days, err := githubarchive.FindDays(ctx, *pathname, layout)
 		if err != nil {
 			log.Fatal(err)
 		}
+		if len(days) == 0 {
+			log.Fatalf("No githubarchive files found in '%s' with the %s layout", *pathname, layout.Name())
+		}
 
 		numCPUs := runtime.NumCPU()
 		runtime.GOMAXPROCS(numCPUs + 1)
 
 		var wg sync.WaitGroup
 
-		pathChan := make(chan string, 100)
+		dayChan := make(chan time.Time, 100)
 
 		worker := func() {
 			defer wg.Done()
-			for path := range pathChan {
-				err := analyzeDay(path)
-				if err != nil {
-					fmt.Printf("Failed to process '%s': %s\n", path, err.Error())
-					panic(err)
+			for day := range dayChan {
+				err := analyzeDay(ctx, *pathname, layout, day, *lenient)
+				if err == context.Canceled {
+					return
+				} else if err != nil {
+					// keep going with the other days, the failed day will be retried on the next run
+					fmt.Printf("Failed to process '%s': %s\n", day.Format("2006-01-02"), err.Error())
 				}
 			}
 		}
@@ -106,16 +171,27 @@ func main() {
 			go worker()
 		}
 
-		for _, dir := range dirs {
-			pathChan <- dir
+	Loop:
+		for _, day := range days {
+			select {
+			case <-ctx.Done():
+				break Loop
+			case dayChan <- day:
+			}
 		}
-		close(pathChan)
+		close(dayChan)
 		wg.Wait()
 
 	} else if len(*filename) > 0 {
-		err := analyzeDay(*filename)
+		basedir, day, err := githubarchive.SplitDayPath(*filename, layout)
 		if err != nil {
-			panic(err)
+			log.Fatal(err)
+		}
+
+		err = analyzeDay(ctx, basedir, layout, day, *lenient)
+		if err != nil && err != context.Canceled {
+			fmt.Printf("Failed to process '%s': %s\n", day.Format("2006-01-02"), err.Error())
+			os.Exit(1)
 		}
 	} else {
 		flag.Usage()
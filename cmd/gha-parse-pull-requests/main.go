@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path"
+	"runtime"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/benfred/github-analysis/config"
+	"github.com/benfred/github-analysis/githubarchive"
+)
+
+func analyzeDay(ctx context.Context, basedir string, layout githubarchive.Layout, day time.Time, lenient bool) error {
+	outputfilename := path.Join(basedir, layout.DayFilePath(day, "parsed_pull_requests.tsv"))
+	if _, err := os.Stat(outputfilename); !os.IsNotExist(err) {
+		fmt.Printf("Skipping '%s' - already exists\n", outputfilename)
+		return nil
+	}
+
+	it, err := githubarchive.NewRangeScanner(ctx, basedir, layout, day, day.AddDate(0, 0, 1))
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	it.Lenient = lenient
+	it.Filter = &githubarchive.Filter{Types: []string{"PullRequestEvent"}}
+
+	output, err := os.Create(outputfilename)
+	if err != nil {
+		return fmt.Errorf("Failed to open file '%s' for writing: %s", outputfilename, err.Error())
+	}
+	defer output.Close()
+
+	events, failed := 0, 0
+	for it.Scan() {
+		events++
+		event := it.Event()
+
+		pr, err := githubarchive.ParsePullRequestEvent(it.Bytes())
+		if err != nil {
+			failed++
+			continue
+		}
+
+		merged, crossRepo := 0, 0
+		if pr.Merged {
+			merged = 1
+		}
+		if pr.IsCrossRepo() {
+			crossRepo = 1
+		}
+
+		createdUTC := ""
+		if !event.Time.IsZero() {
+			createdUTC = event.Time.Format(time.RFC3339)
+		}
+
+		fmt.Fprintf(output, "%d\t%s\t%s\t%d\t%s\t%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%s\t%d\t%s\t%s\n",
+			event.RepoID,
+			event.RepoName,
+			event.RepoLanguage,
+			event.UserID,
+			event.UserName,
+			pr.Action,
+			pr.Number,
+			merged,
+			pr.Additions,
+			pr.Deletions,
+			pr.ChangedFiles,
+			pr.Commits,
+			pr.HeadRepoID,
+			pr.HeadRepoName,
+			crossRepo,
+			pr.AuthorAssociation,
+			createdUTC)
+	}
+
+	// don't leave a partial file behind if we were interrupted or failed to read an
+	// hour, since it would be skipped as already existing on the next run
+	if err := it.Err(); err != nil {
+		output.Close()
+		os.Remove(outputfilename)
+		return err
+	}
+
+	for _, damaged := range it.Damaged() {
+		fmt.Printf("Skipped %d lines (%d bytes) in '%s'", damaged.SkippedLines, damaged.SkippedBytes, damaged.Filename)
+		if damaged.ReadErr != nil {
+			fmt.Printf(" - stopped reading early: %s", damaged.ReadErr.Error())
+		}
+		fmt.Printf("\n")
+	}
+
+	if failed > 0 {
+		fmt.Printf("Parse warnings for '%s': pull_request_errors=%d\n", outputfilename, failed)
+	}
+
+	fmt.Printf("Finished analyzing '%s' - %d events\n", outputfilename, events)
+	return nil
+}
+
+func main() {
+	filename := flag.String("filename", "", "Day to process, like /data/githubarchive/2015/01/02 (or /data/githubarchive/2015-01-02 with the flat layout)")
+	pathname := flag.String("path", "", "path to process")
+	layoutName := flag.String("layout", config.ReadIfExists("config.toml").GithubarchiveLayout,
+		"Layout of the githubarchive files: nested or flat, defaults to githubarchivelayout in config.toml")
+	lenient := flag.Bool("lenient", false, "Skip malformed lines and truncated files instead of failing the day")
+	flag.Parse()
+
+	layout, err := githubarchive.ParseLayout(*layoutName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// try to cleanup gracefully on system interrupts
+	ctx, cancel := context.WithCancel(context.Background())
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-c
+		cancel()
+	}()
+
+	if len(*pathname) > 0 {
+		days, err := githubarchive.FindDays(ctx, *pathname, layout)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(days) == 0 {
+			log.Fatalf("No githubarchive files found in '%s' with the %s layout", *pathname, layout.Name())
+		}
+
+		numCPUs := runtime.NumCPU()
+		runtime.GOMAXPROCS(numCPUs + 1)
+
+		var wg sync.WaitGroup
+
+		dayChan := make(chan time.Time, 100)
+
+		worker := func() {
+			defer wg.Done()
+			for day := range dayChan {
+				err := analyzeDay(ctx, *pathname, layout, day, *lenient)
+				if err == context.Canceled {
+					return
+				} else if err != nil {
+					// keep going with the other days, the failed day will be retried on the next run
+					fmt.Printf("Failed to process '%s': %s\n", day.Format("2006-01-02"), err.Error())
+				}
+			}
+		}
+
+		for i := 0; i < numCPUs; i++ {
+			wg.Add(1)
+			go worker()
+		}
+
+	Loop:
+		for _, day := range days {
+			select {
+			case <-ctx.Done():
+				break Loop
+			case dayChan <- day:
+			}
+		}
+		close(dayChan)
+		wg.Wait()
+
+	} else if len(*filename) > 0 {
+		basedir, day, err := githubarchive.SplitDayPath(*filename, layout)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		err = analyzeDay(ctx, basedir, layout, day, *lenient)
+		if err != nil && err != context.Canceled {
+			fmt.Printf("Failed to process '%s': %s\n", day.Format("2006-01-02"), err.Error())
+			os.Exit(1)
+		}
+	} else {
+		flag.Usage()
+	}
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	githubanalysis "github.com/benfred/github-analysis"
+	"github.com/benfred/github-analysis/config"
+	"github.com/benfred/github-analysis/githubarchive"
+)
+
+func analyzeDay(ctx context.Context, basedir string, layout githubarchive.Layout, day time.Time, tracker *githubarchive.LifecycleTracker) error {
+	it, err := githubarchive.NewRangeScanner(ctx, basedir, layout, day, day.AddDate(0, 0, 1))
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	it.Filter = &githubarchive.Filter{Types: githubarchive.LifecycleEventTypes}
+
+	for it.Scan() {
+		tracker.Observe(it.Event(), it.Bytes())
+	}
+	return it.Err()
+}
+
+// formatTime formats a lifecycle time for the TSV, leaving times that weren't seen empty
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func main() {
+	pathname := flag.String("path", "", "Githubarchive directory to process")
+	layoutName := flag.String("layout", config.ReadIfExists("config.toml").GithubarchiveLayout,
+		"Layout of the githubarchive files: nested or flat, defaults to githubarchivelayout in config.toml")
+	useDB := flag.Bool("db", false, "Update the created dates and deleted flags of the repos in postgres")
+	flag.Parse()
+
+	if len(*pathname) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	layout, err := githubarchive.ParseLayout(*layoutName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// try to cleanup gracefully on system interrupts
+	ctx, cancel := context.WithCancel(context.Background())
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-c
+		cancel()
+	}()
+
+	days, err := githubarchive.FindDays(ctx, *pathname, layout)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(days) == 0 {
+		log.Fatalf("No githubarchive files found in '%s' with the %s layout", *pathname, layout.Name())
+	}
+
+	tracker := githubarchive.NewLifecycleTracker()
+	numCPUs := runtime.NumCPU()
+	var wg sync.WaitGroup
+	dayChan := make(chan time.Time, 100)
+
+	var failedMutex sync.Mutex
+	var failed []string
+
+	worker := func() {
+		defer wg.Done()
+		for day := range dayChan {
+			err := analyzeDay(ctx, *pathname, layout, day, tracker)
+			if err == context.Canceled {
+				return
+			} else if err != nil {
+				fmt.Printf("Failed to process '%s': %s\n", day.Format("2006-01-02"), err.Error())
+				failedMutex.Lock()
+				failed = append(failed, day.Format("2006-01-02"))
+				failedMutex.Unlock()
+			}
+		}
+	}
+
+	for i := 0; i < numCPUs; i++ {
+		wg.Add(1)
+		go worker()
+	}
+
+Loop:
+	for _, day := range days {
+		select {
+		case <-ctx.Done():
+			break Loop
+		case dayChan <- day:
+		}
+	}
+	close(dayChan)
+	wg.Wait()
+
+	// a partial timeline would set the wrong created dates
+	if ctx.Err() != nil {
+		log.Fatal(ctx.Err())
+	}
+	if len(failed) > 0 {
+		sort.Strings(failed)
+		log.Fatalf("Failed to process %d days, not writing a partial timeline: %s", len(failed), strings.Join(failed, " "))
+	}
+
+	repos := tracker.Repos()
+	outputfilename := path.Join(*pathname, "repo_lifecycle.tsv")
+	output, err := os.Create(outputfilename)
+	if err != nil {
+		log.Fatalf("Failed to open file '%s' for writing: %s", outputfilename, err.Error())
+	}
+	for _, repo := range repos {
+		fmt.Fprintf(output, "%d\t%s\t%s\t%s\n", repo.ID, repo.Name,
+			formatTime(repo.Created), formatTime(repo.Public))
+	}
+	if err := output.Close(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("Wrote '%s' - %d repos\n", outputfilename, len(repos))
+
+	if *useDB {
+		db, err := githubanalysis.Connect(config.Read("config.toml"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer db.Close()
+
+		updated, err := db.UpdateRepoLifecycles(repos)
+		if err != nil {
+			log.Fatalf("Failed to update repos: %s", err.Error())
+		}
+
+		deleted, err := db.MarkDeletedRepos()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Updated %d repos, marked %d repos that returned a 404 as deleted\n", updated, deleted)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	githubanalysis "github.com/benfred/github-analysis"
+	"github.com/benfred/github-analysis/config"
+	"github.com/benfred/github-analysis/githubarchive"
+)
+
+// eventTime returns the time of an event in a parsed_events.tsv file. Older files don't
+// have the UTC time column, so this falls back to the day the file is for
+func eventTime(fields []string, day time.Time) time.Time {
+	if len(fields) >= 10 {
+		if t, err := time.Parse(time.RFC3339, fields[9]); err == nil {
+			return t
+		}
+	}
+	return day
+}
+
+// observeDay adds the repos and users from a parsed_events.tsv file to the resolvers
+func observeDay(filename string, day time.Time, ids *githubarchive.Identities) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 6 {
+			continue
+		}
+
+		at := eventTime(fields, day)
+		if repoID, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+			ids.Repos.Observe(repoID, fields[2], at)
+		}
+		if userID, err := strconv.ParseInt(fields[4], 10, 64); err == nil {
+			ids.Users.Observe(userID, fields[5], at)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("Failed to read '%s': %s", filename, err.Error())
+	}
+	return nil
+}
+
+// resolveDay writes a copy of a parsed_events.tsv file with the ids of the repos, users and
+// forks that only had names filled in, and renamed repos replaced by their canonical
+// name. Returns the number of events that were changed
+func resolveDay(filename string, outputfilename string, day time.Time, ids *githubarchive.Identities) (int, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	output, err := os.Create(outputfilename)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to open file '%s' for writing: %s", outputfilename, err.Error())
+	}
+	writer := bufio.NewWriter(output)
+
+	changed := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		fields := strings.Split(line, "\t")
+		if len(fields) < 8 {
+			fmt.Fprintln(writer, line)
+			continue
+		}
+
+		event := &githubarchive.Event{RepoID: -1, RepoName: fields[2], UserID: -1, UserName: fields[5],
+			Time: eventTime(fields, day)}
+		if repoID, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+			event.RepoID = repoID
+		}
+		if userID, err := strconv.ParseInt(fields[4], 10, 64); err == nil {
+			event.UserID = userID
+		}
+		backfilled := ids.Backfill(event)
+
+		// 2013/2014 fork events only have the name of the fork
+		if forkID, err := strconv.ParseInt(fields[6], 10, 64); err == nil && forkID <= 0 && fields[7] != "" {
+			if id, ok := ids.Repos.ResolveID(fields[7], event.Time); ok {
+				fields[6] = strconv.FormatInt(id, 10)
+				backfilled = true
+			}
+		}
+
+		if backfilled {
+			fields[1] = strconv.FormatInt(event.RepoID, 10)
+			fields[2] = event.RepoName
+			fields[4] = strconv.FormatInt(event.UserID, 10)
+			changed++
+		}
+		fmt.Fprintln(writer, strings.Join(fields, "\t"))
+	}
+	if err := scanner.Err(); err != nil {
+		output.Close()
+		return changed, fmt.Errorf("Failed to read '%s': %s", filename, err.Error())
+	}
+	if err := writer.Flush(); err != nil {
+		output.Close()
+		return changed, err
+	}
+	return changed, output.Close()
+}
+
+func save(filename string, resolver *githubarchive.IdentityResolver) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("Failed to open file '%s' for writing: %s", filename, err.Error())
+	}
+	if err := resolver.Save(f); err != nil {
+		f.Close()
+		return err
+	}
+	fmt.Printf("Wrote '%s'\n", filename)
+	return f.Close()
+}
+
+func main() {
+	pathname := flag.String("path", "", "Githubarchive directory containing the parsed_events.tsv files")
+	layoutName := flag.String("layout", config.ReadIfExists("config.toml").GithubarchiveLayout,
+		"Layout of the githubarchive files: nested or flat, defaults to githubarchivelayout in config.toml")
+	useDB := flag.Bool("db", false, "Also load the names of the scraped repos and users from postgres")
+	flag.Parse()
+
+	if len(*pathname) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	layout, err := githubarchive.ParseLayout(*layoutName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// try to cleanup gracefully on system interrupts
+	ctx, cancel := context.WithCancel(context.Background())
+	c := make(chan os.Signal, 2)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-c
+		cancel()
+	}()
+
+	ids := githubarchive.NewIdentities()
+	if *useDB {
+		db, err := githubanalysis.Connect(config.Read("config.toml"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := db.LoadIdentities(ids); err != nil {
+			log.Fatal(err)
+		}
+		db.Close()
+	}
+
+	days, err := githubarchive.FindDays(ctx, *pathname, layout)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(days) == 0 {
+		log.Fatalf("No githubarchive files found in '%s' with the %s layout", *pathname, layout.Name())
+	}
+	var parsed []time.Time
+	for _, day := range days {
+		if ctx.Err() != nil {
+			log.Fatal(ctx.Err())
+		}
+
+		filename := path.Join(*pathname, layout.DayFilePath(day, "parsed_events.tsv"))
+		if _, err := os.Stat(filename); os.IsNotExist(err) {
+			fmt.Printf("Skipping '%s' - not parsed yet\n", filename)
+			continue
+		}
+		if err := observeDay(filename, day, ids); err != nil {
+			log.Fatal(err)
+		}
+		parsed = append(parsed, day)
+	}
+
+	if err := save(path.Join(*pathname, "repo_identities.tsv"), ids.Repos); err != nil {
+		log.Fatal(err)
+	}
+	if err := save(path.Join(*pathname, "user_identities.tsv"), ids.Users); err != nil {
+		log.Fatal(err)
+	}
+
+	// now that every name has been seen, fill in the ids that are missing from the events
+	for _, day := range parsed {
+		if ctx.Err() != nil {
+			log.Fatal(ctx.Err())
+		}
+
+		filename := path.Join(*pathname, layout.DayFilePath(day, "parsed_events.tsv"))
+		outputfilename := path.Join(*pathname, layout.DayFilePath(day, "parsed_events_resolved.tsv"))
+		changed, err := resolveDay(filename, outputfilename, day, ids)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Wrote '%s' - %d events resolved\n", outputfilename, changed)
+	}
+}
@@ -2,16 +2,30 @@ package config
 
 import (
 	"log"
+	"os"
 
 	"github.com/BurntSushi/toml"
 )
 
 // Config for this package
 type Config struct {
-	GithubarchivePath string
-	Database          Database
-	GitHubCredentials []GitHubCredentials
-	GoogleMapsKey     string
+	GithubarchivePath         string
+	GithubarchiveLayout       string
+	GithubarchiveURL          string
+	GithubarchiveMirror       string
+	GithubarchiveMirrorLayout string
+	Download                  Download
+	Database                  Database
+	GitHubCredentials         []GitHubCredentials
+	GoogleMapsKey             string
+}
+
+// Download controls how files are fetched from the githubarchive
+type Download struct {
+	UserAgent      string
+	TimeoutMinutes int
+	BytesPerSecond int64
+	RefreshHours   int
 }
 
 // Database defines the login credentials for the metadata in the db
@@ -38,3 +52,11 @@ func Read(filename string) Config {
 	}
 	return ret
 }
+
+// ReadIfExists is like Read, but returns an empty config if the file doesn't exist
+func ReadIfExists(filename string) Config {
+	if _, err := os.Stat(filename); os.IsNotExist(err) {
+		return Config{}
+	}
+	return Read(filename)
+}
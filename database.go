@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/benfred/github-analysis/config"
+	"github.com/benfred/github-analysis/githubarchive"
 	"github.com/google/go-github/github"
 	"github.com/lib/pq"
 )
@@ -241,3 +242,111 @@ func (conn *Database) InsertOrganizationMembers(orgid int64, orgname string, mem
 	_, err := conn.Exec(sql, orgid, pq.Array(memberids), fetchtime, statuscode)
 	return err
 }
+
+// LoadIdentities adds the names of the scraped repos and users to the identity resolvers,
+// as of the time they were fetched
+func (conn *Database) LoadIdentities(ids *githubarchive.Identities) error {
+	err := conn.loadIdentities("SELECT id, name, fetched from repos where statuscode=200 and fetched is not null", ids.Repos)
+	if err != nil {
+		return err
+	}
+	return conn.loadIdentities("SELECT id, login, fetched from users where statuscode=200 and fetched is not null", ids.Users)
+}
+
+func (conn *Database) loadIdentities(query string, resolver *githubarchive.IdentityResolver) error {
+	rows, err := conn.Query(query)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var name string
+		var fetched time.Time
+		if err := rows.Scan(&id, &name, &fetched); err != nil {
+			return err
+		}
+		resolver.Observe(id, name, fetched.UTC())
+	}
+	return rows.Err()
+}
+
+// BotLogins returns the logins of the scraped users that github reports as bots
+func (conn *Database) BotLogins() ([]string, error) {
+	rows, err := conn.Query("SELECT login from users where type='Bot'")
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+	var logins []string
+	for rows.Next() {
+		var login string
+		if err := rows.Scan(&login); err != nil {
+			return nil, err
+		}
+		logins = append(logins, login)
+	}
+	return logins, rows.Err()
+}
+
+// UpdateRepoLifecycles fills in the created dates of repos from the archive when they're
+// missing from the api data. The
+// repos are copied into a temporary table and updated in a single transaction, so that a
+// failure doesn't leave a partial timeline behind. Returns the number of repos updated
+func (conn *Database) UpdateRepoLifecycles(repos []*githubarchive.RepoLifecycle) (int64, error) {
+	txn, err := conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer txn.Rollback()
+
+	if _, err := txn.Exec(`CREATE TEMP TABLE repo_lifecycle (id integer, created timestamp without time zone)
+		ON COMMIT DROP`); err != nil {
+		return 0, err
+	}
+
+	stmt, err := txn.Prepare(pq.CopyIn("repo_lifecycle", "id", "created"))
+	if err != nil {
+		return 0, err
+	}
+	for _, repo := range repos {
+		var created *time.Time
+		if !repo.Created.IsZero() {
+			created = &repo.Created
+		}
+		if _, err := stmt.Exec(repo.ID, created); err != nil {
+			stmt.Close()
+			return 0, fmt.Errorf("Failed to copy repo %d: %s", repo.ID, err.Error())
+		}
+	}
+	if _, err := stmt.Exec(); err != nil {
+		stmt.Close()
+		return 0, err
+	}
+	if err := stmt.Close(); err != nil {
+		return 0, err
+	}
+
+	result, err := txn.Exec(`UPDATE repos SET created=COALESCE(repos.created, l.created)
+		FROM repo_lifecycle l WHERE repos.id=l.id AND repos.created IS NULL`)
+	if err != nil {
+		return 0, err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return updated, txn.Commit()
+}
+
+// MarkDeletedRepos marks the repos that the scraper got a 404 for as deleted, returning the
+// number of repos updated
+func (conn *Database) MarkDeletedRepos() (int64, error) {
+	result, err := conn.Exec("UPDATE repos SET deleted=true WHERE statuscode=404 AND NOT deleted")
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
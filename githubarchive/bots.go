@@ -0,0 +1,198 @@
+package githubarchive
+
+import (
+	"bufio"
+	"fmt"
+	"math/bits"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// knownBots are logins of popular bots that don't follow any naming pattern
+var knownBots = map[string]bool{
+	"dependabot":        true,
+	"greenkeeperio-bot": true,
+	"renovate":          true,
+	"pyup-bot":          true,
+	"codecov-io":        true,
+	"coveralls":         true,
+	"imgbot":            true,
+	"allcontributors":   true,
+	"travis-ci":         true,
+	"netlify":           true,
+	"web-flow":          true,
+}
+
+// IsBotLogin returns if a login looks like a bot from the name alone, like the [bot]
+// suffix used by github apps or a -bot suffix
+func IsBotLogin(login string) bool {
+	login = strings.ToLower(login)
+	if knownBots[login] || strings.HasSuffix(login, "[bot]") {
+		return true
+	}
+	return strings.HasSuffix(login, "-bot") || strings.HasSuffix(login, "_bot") ||
+		strings.HasPrefix(login, "bot-") || strings.HasSuffix(login, "-ci")
+}
+
+// Bot classification reasons
+const (
+	BotReasonDenied   = "denied"
+	BotReasonLogin    = "login"
+	BotReasonUserType = "user_type"
+	BotReasonRate     = "event_rate"
+	BotReasonAllDay   = "active_all_day"
+)
+
+// BotClassifier flags accounts that are likely automated, so that they can be left out of
+// the active user counts. Besides the login, it looks at the account type from the
+// scraped users, and the activity seen through Observe: accounts with more than
+// MaxEventsPerDay events or that were active in MaxActiveHours hours of a single day
+type BotClassifier struct {
+	// Allow and Deny override the classification for logins
+	Allow map[string]bool
+	Deny  map[string]bool
+
+	// UserTypes are the logins that github reports as having the 'Bot' type
+	UserTypes map[string]bool
+
+	MaxEventsPerDay int
+	MaxActiveHours  int
+
+	mutex    sync.Mutex
+	activity map[string]*botActivity
+}
+
+// botActivity tracks the busiest day seen for a login
+type botActivity struct {
+	day    time.Time
+	events int
+	hours  uint32
+
+	maxEvents int
+	maxHours  int
+}
+
+// NewBotClassifier returns a classifier flagging accounts with more than 2000 events in a
+// day, or activity in 23 or more hours of a day
+func NewBotClassifier() *BotClassifier {
+	return &BotClassifier{
+		Allow:           make(map[string]bool),
+		Deny:            make(map[string]bool),
+		UserTypes:       make(map[string]bool),
+		MaxEventsPerDay: 2000,
+		MaxActiveHours:  23,
+		activity:        make(map[string]*botActivity),
+	}
+}
+
+// LoadOverrides reads a list of 'allow <login>' and 'deny <login>' lines into the
+// classifier. Blank lines and lines starting with # are ignored, and a missing file is
+// treated as empty
+func (c *BotClassifier) LoadOverrides(filename string) error {
+	f, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return fmt.Errorf("Failed to parse '%s': invalid line '%s'", filename, line)
+		}
+		switch fields[0] {
+		case "allow":
+			c.Allow[strings.ToLower(fields[1])] = true
+		case "deny":
+			c.Deny[strings.ToLower(fields[1])] = true
+		default:
+			return fmt.Errorf("Failed to parse '%s': expected allow or deny, got '%s'", filename, fields[0])
+		}
+	}
+	return scanner.Err()
+}
+
+// Observe records that login had an event at a point in time. Events for each login are
+// expected to be observed in chronological order
+func (c *BotClassifier) Observe(login string, at time.Time) {
+	at = at.UTC()
+	day := at.Truncate(24 * time.Hour)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	activity := c.activity[login]
+	if activity == nil {
+		activity = &botActivity{day: day}
+		c.activity[login] = activity
+	} else if !activity.day.Equal(day) {
+		activity.day, activity.events, activity.hours = day, 0, 0
+	}
+
+	activity.events++
+	activity.hours |= 1 << uint(at.Hour())
+	if activity.events > activity.maxEvents {
+		activity.maxEvents = activity.events
+	}
+	if hours := bits.OnesCount32(activity.hours); hours > activity.maxHours {
+		activity.maxHours = hours
+	}
+}
+
+// Classify returns if login is likely a bot, and the reason why
+func (c *BotClassifier) Classify(login string) (bool, string) {
+	lower := strings.ToLower(login)
+	if c.Allow[lower] {
+		return false, ""
+	}
+	if c.Deny[lower] {
+		return true, BotReasonDenied
+	}
+	if IsBotLogin(login) {
+		return true, BotReasonLogin
+	}
+	if c.UserTypes[lower] {
+		return true, BotReasonUserType
+	}
+
+	c.mutex.Lock()
+	activity := c.activity[login]
+	c.mutex.Unlock()
+	if activity != nil {
+		if c.MaxEventsPerDay > 0 && activity.maxEvents > c.MaxEventsPerDay {
+			return true, BotReasonRate
+		}
+		if c.MaxActiveHours > 0 && activity.maxHours >= c.MaxActiveHours {
+			return true, BotReasonAllDay
+		}
+	}
+	return false, ""
+}
+
+// Bots returns every observed login that is classified as a bot, along with the reason
+func (c *BotClassifier) Bots() map[string]string {
+	c.mutex.Lock()
+	logins := make([]string, 0, len(c.activity))
+	for login := range c.activity {
+		logins = append(logins, login)
+	}
+	c.mutex.Unlock()
+
+	bots := make(map[string]string)
+	for _, login := range logins {
+		if bot, reason := c.Classify(login); bot {
+			bots[login] = reason
+		}
+	}
+	return bots
+}
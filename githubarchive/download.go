@@ -1,18 +1,158 @@
 package githubarchive
 
 import (
+	"compress/gzip"
+	"context"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"path"
+	"strings"
 	"time"
 )
 
+// statusError is returned when githubarchive responds with a non-200 status code
+type statusError struct {
+	url        string
+	status     string
+	statusCode int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("Failed to download '%s' -  %s", e.url, e.status)
+}
+
+// isTransient returns whether a download error is worth retrying. Network errors and
+// server side errors are retried, but 404's and other client errors are not
+func isTransient(err error) bool {
+	if IsNotFound(err) {
+		return false
+	}
+	if serr, ok := err.(*statusError); ok {
+		return serr.statusCode >= 500 || serr.statusCode == http.StatusTooManyRequests
+	}
+	return true
+}
+
 // MaybeDownloadFile checks if the githubarchive file is missing, and if so downloads it
 func MaybeDownloadFile(basedir string, year int, month int, day int, hour int, dryrun bool) error {
-	dir := path.Join(basedir, fmt.Sprintf("%04d", year), fmt.Sprintf("%02d", month), fmt.Sprintf("%02d", day))
+	return MaybeDownloadFileContext(context.Background(), basedir, year, month, day, hour, dryrun)
+}
+
+// MaybeDownloadFileContext is like MaybeDownloadFile, but stops the download when ctx
+// is cancelled. A cancelled download never leaves a partial file behind
+func MaybeDownloadFileContext(ctx context.Context, basedir string, year int, month int, day int, hour int, dryrun bool) error {
+	t := time.Date(year, time.Month(month), day, hour, 0, 0, 0, time.UTC)
+	filename := path.Join(basedir, NestedLayout.HourPath(t))
+	downloaded, bytes, err := maybeDownloadHour(ctx, NewHTTPSource(DefaultArchiveURL), filename, t, dryrun, false)
+	if downloaded {
+		fmt.Printf("Downloaded %d bytes to '%s'\n", bytes, filename)
+	}
+	return err
+}
+
+// maybeDownloadHour copies the file for an hour from the source to filename if it doesn't exist
+// already, returning whether or not the file was fetched and its size. If refresh is
+// set and the source supports conditional requests, existing files are replaced if the
+// source has a newer version
+func maybeDownloadHour(ctx context.Context, source ArchiveSource, filename string, hour time.Time,
+	dryrun bool, refresh bool) (bool, int64, error) {
+	stat, err := os.Stat(filename)
+	exists := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return false, 0, err
+	}
+
+	conditional, isConditional := source.(ConditionalSource)
+	if exists && !(refresh && isConditional) {
+		return false, 0, nil
+	}
+
+	// dry-run messages go to stderr, so that stdout can be kept for json progress
+	if dryrun {
+		if exists {
+			fmt.Fprintf(os.Stderr, "dry-run: refreshing %s\n", source.Location(hour))
+		} else {
+			fmt.Fprintf(os.Stderr, "dry-run: downloading %s\n", source.Location(hour))
+		}
+		return false, 0, nil
+	}
+
+	if err := ensureDir(path.Dir(filename)); err != nil {
+		return false, 0, err
+	}
+
+	var contents io.ReadCloser
+	var version FileVersion
+	if isConditional {
+		var local FileVersion
+		if exists {
+			local = readFileVersion(filename, stat.ModTime())
+		}
+		contents, version, err = conditional.OpenIfModified(ctx, hour, local)
+		if err == ErrNotModified {
+			return false, 0, nil
+		}
+	} else {
+		contents, err = source.Open(ctx, hour)
+	}
+	if err != nil {
+		return false, 0, err
+	}
+	defer contents.Close()
+
+	bytes, err := writeFileAtomic(filename, contents)
+	if err != nil {
+		return false, 0, err
+	}
+	if isConditional {
+		if err := writeFileVersion(filename, version); err != nil {
+			return true, bytes, err
+		}
+	}
+	return true, bytes, nil
+}
+
+// versionFilename is where the ETag and Last-Modified time of a downloaded file are kept
+func versionFilename(filename string) string {
+	return filename + ".version"
+}
+
+// readFileVersion returns the version of a previously downloaded file. Files downloaded
+// without version information fall back to using the local modification time
+func readFileVersion(filename string, modTime time.Time) FileVersion {
+	contents, err := ioutil.ReadFile(versionFilename(filename))
+	if err != nil {
+		return FileVersion{ModTime: modTime}
+	}
+
+	var version FileVersion
+	lines := strings.Split(string(contents), "\n")
+	version.ETag = lines[0]
+	if len(lines) > 1 {
+		version.ModTime, _ = http.ParseTime(lines[1])
+	}
+	return version
+}
+
+// writeFileVersion stores the ETag and Last-Modified time of a downloaded file
+func writeFileVersion(filename string, version FileVersion) error {
+	if version.ETag == "" && version.ModTime.IsZero() {
+		os.Remove(versionFilename(filename))
+		return nil
+	}
 
+	modified := ""
+	if !version.ModTime.IsZero() {
+		modified = version.ModTime.UTC().Format(http.TimeFormat)
+	}
+	return ioutil.WriteFile(versionFilename(filename), []byte(version.ETag+"\n"+modified+"\n"), 0644)
+}
+
+// ensureDir creates the directory if it doesn't already exist
+func ensureDir(dir string) error {
 	if stat, err := os.Stat(dir); err != nil {
 		if os.IsNotExist(err) {
 			// try creating the dir
@@ -26,74 +166,107 @@ func MaybeDownloadFile(basedir string, year int, month int, day int, hour int, d
 	} else if !stat.IsDir() {
 		return fmt.Errorf("'%s' is not a directory", dir)
 	}
+	return nil
+}
 
-	filename := path.Join(dir, fmt.Sprintf("%d.json.gz", hour))
-	if _, err := os.Stat(filename); err != nil {
-		if os.IsNotExist(err) {
-			url := fmt.Sprintf("http://data.githubarchive.org/%04d-%02d-%02d-%d.json.gz", year, month, day, hour)
-			if dryrun {
-				fmt.Printf("dry-run: downloading %s\n", url)
-				return nil
-			}
+// writeFileAtomic writes the contents of r to a temporary file alongside filename, and
+// only renames it into place after checking that the gzip stream is complete. This
+// means an interrupted download never leaves a truncated file behind
+func writeFileAtomic(filename string, r io.Reader) (int64, error) {
+	f, err := ioutil.TempFile(path.Dir(filename), "."+path.Base(filename)+".")
+	if err != nil {
+		return 0, err
+	}
+	tempname := f.Name()
 
-			resp, err := http.Get(url)
-			if err != nil {
-				return err
-			}
-			defer resp.Body.Close()
+	// TempFile creates files that are only readable by the owner
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		os.Remove(tempname)
+		return 0, err
+	}
 
-			if resp.StatusCode != 200 {
-				return fmt.Errorf("Failed to download '%s' -  %s", url, resp.Status)
-			}
+	bytes, err := io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = validateGzip(tempname)
+	}
+	if err == nil {
+		err = os.Rename(tempname, filename)
+	}
+	if err != nil {
+		os.Remove(tempname)
+		return 0, err
+	}
+	return bytes, nil
+}
 
-			f, err := os.Create(filename)
-			if err != nil {
-				return err
-			}
-			defer f.Close()
+// validateGzip reads through the whole gzip file, returning an error if the file
+// is truncated or otherwise corrupt
+func validateGzip(filename string) error {
+	return validateGzipContext(context.Background(), filename)
+}
 
-			bytes, err := io.Copy(f, resp.Body)
-			if err != nil {
-				return err
-			}
-			fmt.Printf("Downloaded %d bytes to '%s'\n", bytes, filename)
-		} else {
-			return err
-		}
+// validateGzipContext is like validateGzip, but stops reading when ctx is cancelled
+func validateGzipContext(ctx context.Context, filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
 	}
+	defer f.Close()
 
-	return nil
-}
+	gr, err := gzip.NewReader(f)
+	if err != nil {
+		return fmt.Errorf("Invalid gzip file '%s': %s", filename, err.Error())
+	}
+	defer gr.Close()
 
-func daysInMonth(year int, m time.Month) int {
-	return time.Date(year, m+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	if _, err := io.Copy(ioutil.Discard, newContextReader(ctx, gr)); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("Invalid gzip file '%s': %s", filename, err.Error())
+	}
+	return nil
 }
 
 // DownloadFiles copies githubarchive files locally
 func DownloadFiles(pathname string) error {
-	now := time.Now()
+	return DownloadFilesContext(context.Background(), pathname)
+}
 
+// DownloadFilesContext is like DownloadFiles, but stops downloading when ctx is cancelled
+func DownloadFilesContext(ctx context.Context, pathname string) error {
+	now := time.Now().UTC()
 	fmt.Printf("year %d month %d day %d hour %d\n", now.Year(), now.Month(), now.Day(), now.Hour())
-	// for year := 2012; year <= now.Year(); year++ {
-	for year := now.Year(); year >= 2011; year-- {
-		endMonth := time.December
-		if year == now.Year() {
-			endMonth = now.Month()
-		}
 
-		for month := time.January; month <= endMonth; month++ {
-			endDay := daysInMonth(year, month)
-			if year == now.Year() && month == now.Month() {
-				endDay = now.Day() - 1
-			}
+	// only download up to the end of yesterday, since today is still being written
+	end := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
 
-			for day := 1; day <= endDay; day++ {
-				for hour := 0; hour < 24; hour++ {
-					MaybeDownloadFile(pathname, year, int(month), day, hour, false)
-				}
-			}
+	outages, err := LoadOutageCalendar(path.Join(pathname, OutageFilename))
+	if err != nil {
+		return err
+	}
+
+	downloader := NewDownloader(pathname)
+	downloader.Outages = outages
+	downloader.Progress = func(progress DownloadProgress) {
+		if progress.Status == StatusDownloaded {
+			fmt.Printf("Downloaded '%s'\n", downloader.hourPath(progress.Hour))
+		} else if progress.Err != nil {
+			fmt.Printf("Error downloading %s: %s\n", progress.Hour.Format(hourFormat), progress.Err.Error())
 		}
 	}
+	summary := downloader.DownloadContext(ctx, ArchiveStart, end)
+	summary.Print(os.Stdout)
 
-	return nil
+	if err := outages.Save(); err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return summary.Err()
 }
@@ -0,0 +1,277 @@
+package githubarchive
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+// ArchiveStart is the first hour that githubarchive has data for
+var ArchiveStart = time.Date(2011, time.February, 12, 0, 0, 0, 0, time.UTC)
+
+// Downloader fetches githubarchive files using a pool of concurrent workers,
+// retrying transient failures with an exponential backoff
+type Downloader struct {
+	Source  ArchiveSource
+	BaseDir string
+	Layout  Layout
+	Workers int
+	Retries int
+	Backoff time.Duration
+	DryRun  bool
+
+	// RefreshWindow controls how far back to check for updated versions of files that
+	// have already been downloaded. This only works with sources that support
+	// conditional requests, like HTTPSource
+	RefreshWindow time.Duration
+
+	// Progress is called after each hour is processed, and can be used to display
+	// the status of the download. It is never called concurrently
+	Progress func(DownloadProgress)
+
+	// Outages records hours that githubarchive never published. When set, known
+	// outages are skipped and 404's from an HTTPSource are recorded so that they can
+	// be learned
+	Outages *OutageCalendar
+}
+
+// NewDownloader returns a Downloader copying files from the public githubarchive into
+// basedir with the default settings
+func NewDownloader(basedir string) *Downloader {
+	return &Downloader{Source: NewHTTPSource(DefaultArchiveURL), BaseDir: basedir, Layout: NestedLayout,
+		Workers: 4, Retries: 3, Backoff: 5 * time.Second}
+}
+
+// hourPath returns the location of the file for an hour in the BaseDir
+func (d *Downloader) hourPath(hour time.Time) string {
+	return path.Join(d.BaseDir, d.Layout.HourPath(hour))
+}
+
+// FailedHour is an hour that couldn't be downloaded, along with the last error seen
+type FailedHour struct {
+	Hour time.Time
+	Err  error
+}
+
+// DownloadSummary lists which hours were downloaded, skipped or failed
+type DownloadSummary struct {
+	Downloaded []time.Time
+	Skipped    []time.Time
+	KnownGaps  []time.Time
+	Failed     []FailedHour
+}
+
+// Err returns an error if any hours failed to download
+func (s *DownloadSummary) Err() error {
+	if len(s.Failed) > 0 {
+		return fmt.Errorf("Failed to download %d hours", len(s.Failed))
+	}
+	return nil
+}
+
+// Print writes out a human readable version of the summary
+func (s *DownloadSummary) Print(w io.Writer) {
+	fmt.Fprintf(w, "Downloaded %d hours, skipped %d hours, %d known gaps, failed %d hours\n",
+		len(s.Downloaded), len(s.Skipped), len(s.KnownGaps), len(s.Failed))
+	for _, failed := range s.Failed {
+		fmt.Fprintf(w, "  %s: %s\n", failed.Hour.Format(hourFormat), failed.Err.Error())
+	}
+}
+
+// hourFormat matches the naming of files on githubarchive (like 2015-01-01-15)
+const hourFormat = "2006-01-02-15"
+
+// Statuses reported in DownloadProgress
+const (
+	StatusDownloaded = "downloaded"
+	StatusSkipped    = "skipped"
+	StatusKnownGap   = "known_gap"
+	StatusFailed     = "failed"
+	StatusRetrying   = "retrying"
+)
+
+// DownloadProgress is passed to the Downloader's Progress callback as each hour is
+// processed
+type DownloadProgress struct {
+	Hour   time.Time
+	Status string
+	Err    error
+
+	// Done and Total count the hours processed so far, out of the whole range
+	Done  int
+	Total int
+
+	// Bytes is the total number of bytes downloaded so far
+	Bytes   int64
+	Elapsed time.Duration
+
+	// Rate is the current download speed in bytes per second, averaged over the last
+	// RateWindow, and AverageRate is the average over the whole download
+	Rate        float64
+	AverageRate float64
+
+	// ETA is the estimated time remaining, based off the average time per hour so far
+	ETA time.Duration
+}
+
+// RateWindow is how far back DownloadProgress.Rate looks when calculating the current
+// download speed
+const RateWindow = 30 * time.Second
+
+// rateSample is the total number of bytes downloaded at a point in time
+type rateSample struct {
+	at    time.Time
+	bytes int64
+}
+
+// Download fetches every missing hour in the range [start, end), newest hours first.
+// Hours that already exist on disk are skipped, so an interrupted download can
+// be resumed by calling this again
+func (d *Downloader) Download(start time.Time, end time.Time) *DownloadSummary {
+	return d.DownloadContext(context.Background(), start, end)
+}
+
+// DownloadContext is like Download, but stops when ctx is cancelled. Downloads in
+// progress are abandoned without leaving partial files, and hours that weren't
+// started are left out of the summary
+func (d *Downloader) DownloadContext(ctx context.Context, start time.Time, end time.Time) *DownloadSummary {
+	workers := d.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	start = start.UTC().Truncate(time.Hour)
+	end = end.UTC().Truncate(time.Hour)
+	total := 0
+	if end.After(start) {
+		total = int(end.Sub(start) / time.Hour)
+	}
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	summary := &DownloadSummary{}
+	started := time.Now()
+	done := 0
+	var totalBytes int64
+	samples := []rateSample{{started, 0}}
+
+	// record the result for an hour, and report progress. Holds the mutex so that
+	// the Progress callback is never called concurrently
+	record := func(hour time.Time, status string, bytes int64, err error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		switch status {
+		case StatusDownloaded:
+			summary.Downloaded = append(summary.Downloaded, hour)
+		case StatusSkipped:
+			summary.Skipped = append(summary.Skipped, hour)
+		case StatusKnownGap:
+			summary.KnownGaps = append(summary.KnownGaps, hour)
+		case StatusFailed:
+			summary.Failed = append(summary.Failed, FailedHour{hour, err})
+		}
+		if status != StatusRetrying {
+			done++
+		}
+		totalBytes += bytes
+
+		if d.Progress != nil {
+			now := time.Now()
+			elapsed := now.Sub(started)
+			progress := DownloadProgress{Hour: hour, Status: status, Err: err, Done: done, Total: total,
+				Bytes: totalBytes, Elapsed: elapsed}
+			if elapsed > 0 {
+				progress.AverageRate = float64(totalBytes) / elapsed.Seconds()
+			}
+
+			// keep the newest sample that's at least RateWindow old as the start of the window
+			samples = append(samples, rateSample{now, totalBytes})
+			for len(samples) > 1 && now.Sub(samples[1].at) >= RateWindow {
+				samples = samples[1:]
+			}
+			if window := now.Sub(samples[0].at); window > 0 {
+				progress.Rate = float64(totalBytes-samples[0].bytes) / window.Seconds()
+			}
+			if done > 0 {
+				progress.ETA = elapsed / time.Duration(done) * time.Duration(total-done)
+			}
+			d.Progress(progress)
+		}
+	}
+
+	hours := make(chan time.Time, 100)
+
+	worker := func() {
+		defer wg.Done()
+		for hour := range hours {
+			if d.Outages.IsKnownOutage(hour) {
+				if _, err := os.Stat(d.hourPath(hour)); os.IsNotExist(err) {
+					record(hour, StatusKnownGap, 0, nil)
+					continue
+				}
+			}
+
+			downloaded, bytes, err := d.downloadWithRetries(ctx, hour, record)
+			if ctx.Err() != nil {
+				// don't report hours that were interrupted as failures
+				continue
+			} else if err != nil {
+				record(hour, StatusFailed, bytes, err)
+			} else if downloaded {
+				record(hour, StatusDownloaded, bytes, nil)
+			} else {
+				record(hour, StatusSkipped, bytes, nil)
+			}
+		}
+	}
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go worker()
+	}
+
+Loop:
+	for hour := end.Add(-time.Hour); !hour.Before(start); hour = hour.Add(-time.Hour) {
+		select {
+		case <-ctx.Done():
+			break Loop
+		case hours <- hour:
+		}
+	}
+	close(hours)
+	wg.Wait()
+
+	return summary
+}
+
+func (d *Downloader) downloadWithRetries(ctx context.Context, hour time.Time,
+	record func(time.Time, string, int64, error)) (bool, int64, error) {
+	backoff := d.Backoff
+	for attempt := 0; ; attempt++ {
+		refresh := d.RefreshWindow > 0 && time.Since(hour) < d.RefreshWindow
+		downloaded, bytes, err := maybeDownloadHour(ctx, d.Source, d.hourPath(hour), hour, d.DryRun, refresh)
+		// only githubarchive itself is authoritative about missing hours, a 404 from a
+		// mirror could just be a hole in the mirror
+		if _, ok := d.Source.(*HTTPSource); ok && IsNotFound(err) {
+			d.Outages.RecordNotFound(hour)
+		}
+		if err == nil || attempt >= d.Retries || !isTransient(err) || ctx.Err() != nil {
+			return downloaded, bytes, err
+		}
+
+		if record != nil {
+			record(hour, StatusRetrying, 0, fmt.Errorf("%s (retrying in %s)", err.Error(), backoff))
+		}
+		select {
+		case <-ctx.Done():
+			return false, 0, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,203 @@
+package githubarchive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+)
+
+// gzipLines returns the gzipped contents of a githubarchive file with the lines passed in
+func gzipLines(t testing.TB, lines ...string) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	for _, line := range lines {
+		if _, err := w.Write([]byte(line + "\n")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// testServer serves a MemorySource over http, failing the first failures[hour] requests
+// for an hour with a 500 and counting the requests made for each hour
+type testServer struct {
+	*httptest.Server
+	Source *MemorySource
+
+	mutex    sync.Mutex
+	failures map[string]int
+	requests map[string]int
+}
+
+func newTestServer() *testServer {
+	s := &testServer{Source: NewMemorySource(), failures: make(map[string]int), requests: make(map[string]int)}
+	handler := NewSourceHandler(s.Source)
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Base(r.URL.Path)
+		s.mutex.Lock()
+		s.requests[name]++
+		fail := s.failures[name] > 0
+		if fail {
+			s.failures[name]--
+		}
+		s.mutex.Unlock()
+
+		if fail {
+			http.Error(w, "unavailable", http.StatusInternalServerError)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	}))
+	return s
+}
+
+func (s *testServer) Requests(hour time.Time) int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.requests[archiveFilename(hour)]
+}
+
+func newTestDownloader(t *testing.T, server *testServer) *Downloader {
+	basedir, err := ioutil.TempDir("", "githubarchive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Downloader{Source: NewHTTPSource(server.URL), BaseDir: basedir, Layout: FlatLayout,
+		Workers: 2, Retries: 3, Backoff: time.Millisecond}
+}
+
+var testHour = time.Date(2016, time.January, 1, 15, 0, 0, 0, time.UTC)
+
+func TestDownloadRetriesServerErrors(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+	server.Source.Add(testHour, gzipLines(t, `{"type":"PushEvent"}`))
+	server.failures[archiveFilename(testHour)] = 2
+
+	d := newTestDownloader(t, server)
+	defer os.RemoveAll(d.BaseDir)
+
+	retries := 0
+	var last DownloadProgress
+	d.Progress = func(progress DownloadProgress) {
+		if progress.Status == StatusRetrying {
+			retries++
+		}
+		last = progress
+	}
+
+	summary := d.Download(testHour, testHour.Add(time.Hour))
+	if err := summary.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.Downloaded) != 1 || retries != 2 || server.Requests(testHour) != 3 {
+		t.Errorf("Expected 1 download after 2 retries, got %d downloads, %d retries and %d requests",
+			len(summary.Downloaded), retries, server.Requests(testHour))
+	}
+	if _, err := os.Stat(d.hourPath(testHour)); err != nil {
+		t.Error(err)
+	}
+	if last.Bytes == 0 || last.Rate <= 0 || last.AverageRate <= 0 {
+		t.Errorf("Expected the progress to include the download rate, got %+v", last)
+	}
+}
+
+func TestDownloadGivesUpAfterRetries(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+	server.Source.Add(testHour, gzipLines(t, `{"type":"PushEvent"}`))
+	server.failures[archiveFilename(testHour)] = 10
+
+	d := newTestDownloader(t, server)
+	defer os.RemoveAll(d.BaseDir)
+
+	summary := d.Download(testHour, testHour.Add(time.Hour))
+	if len(summary.Failed) != 1 || server.Requests(testHour) != d.Retries+1 {
+		t.Errorf("Expected 1 failure after %d requests, got %d failures and %d requests",
+			d.Retries+1, len(summary.Failed), server.Requests(testHour))
+	}
+}
+
+func TestDownloadDoesntRetryNotFound(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	d := newTestDownloader(t, server)
+	defer os.RemoveAll(d.BaseDir)
+
+	summary := d.Download(testHour, testHour.Add(time.Hour))
+	if len(summary.Failed) != 1 || !IsNotFound(summary.Failed[0].Err) {
+		t.Fatalf("Expected a single not found failure, got %+v", summary.Failed)
+	}
+	if requests := server.Requests(testHour); requests != 1 {
+		t.Errorf("Expected 404 to not be retried, got %d requests", requests)
+	}
+}
+
+func TestDownloadSummary(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	downloaded, skipped, failed := testHour, testHour.Add(time.Hour), testHour.Add(2*time.Hour)
+	server.Source.Add(downloaded, gzipLines(t, `{"type":"PushEvent"}`))
+	server.Source.Add(skipped, gzipLines(t, `{"type":"PushEvent"}`))
+
+	d := newTestDownloader(t, server)
+	defer os.RemoveAll(d.BaseDir)
+	if err := ioutil.WriteFile(d.hourPath(skipped), gzipLines(t, `{"type":"WatchEvent"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	summary := d.Download(testHour, testHour.Add(3*time.Hour))
+	if len(summary.Downloaded) != 1 || !summary.Downloaded[0].Equal(downloaded) {
+		t.Errorf("Expected %s to be downloaded, got %v", downloaded, summary.Downloaded)
+	}
+	if len(summary.Skipped) != 1 || !summary.Skipped[0].Equal(skipped) {
+		t.Errorf("Expected %s to be skipped, got %v", skipped, summary.Skipped)
+	}
+	if len(summary.Failed) != 1 || !summary.Failed[0].Hour.Equal(failed) {
+		t.Errorf("Expected %s to fail, got %v", failed, summary.Failed)
+	}
+	if summary.Err() == nil {
+		t.Error("Expected an error from a summary with failures")
+	}
+	if server.Requests(skipped) != 0 {
+		t.Errorf("Expected existing file to be skipped without a request")
+	}
+}
+
+func TestDownloadRejectsTruncatedFiles(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+	contents := gzipLines(t, `{"type":"PushEvent"}`, `{"type":"WatchEvent"}`)
+	server.Source.Add(testHour, contents[:len(contents)/2])
+
+	d := newTestDownloader(t, server)
+	d.Retries = 0
+	defer os.RemoveAll(d.BaseDir)
+
+	summary := d.Download(testHour, testHour.Add(time.Hour))
+	if len(summary.Failed) != 1 {
+		t.Fatalf("Expected truncated file to fail, got %+v", summary)
+	}
+
+	// the truncated file shouldn't be renamed into place, and the temporary file should
+	// be cleaned up
+	files, err := ioutil.ReadDir(d.BaseDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		t.Errorf("Expected no files after a failed download, found '%s'", file.Name())
+	}
+}
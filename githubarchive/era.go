@@ -0,0 +1,269 @@
+package githubarchive
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/buger/jsonparser"
+)
+
+// EventParser parses the events from one era of the githubarchive schema. The archive
+// has used the timeline format from 2011 to 2014, which changed how forks were stored
+// a couple of times, and the events api format from 2015 onwards
+type EventParser interface {
+	// Era returns the name of the era, like "2015"
+	Era() string
+
+	// Detect returns if the JSON event is from this era
+	Detect(data []byte) bool
+
+	ParseEvent(data []byte) *Event
+	ParseForkEvent(repo string, data []byte) (int64, string)
+}
+
+var (
+	parsersMutex sync.Mutex
+	parsers      atomic.Value
+)
+
+func init() {
+	parsers.Store([]EventParser{
+		&eventsAPIParser{},
+		&timelineParser{era: "2013", firstYear: 2013, lastYear: 2014, parseFork: parseForkEvent2013},
+		&timelineParser{era: "2012", firstYear: 2012, lastYear: 2012, parseFork: parseForkEvent2012},
+		&timelineParser{era: "2011", firstYear: 2011, lastYear: 2011, parseFork: parseForkEvent2011},
+	})
+}
+
+// RegisterParser adds a parser for a new era of the schema. Parsers are checked in the
+// reverse order they were registered, so a new parser takes priority over the built in
+// ones for the events that it detects
+func RegisterParser(parser EventParser) {
+	parsersMutex.Lock()
+	defer parsersMutex.Unlock()
+
+	current := parsers.Load().([]EventParser)
+	updated := make([]EventParser, 0, len(current)+1)
+	updated = append(updated, parser)
+	parsers.Store(append(updated, current...))
+}
+
+// Parsers returns the registered parsers, in the order they're checked
+func Parsers() []EventParser {
+	return parsers.Load().([]EventParser)
+}
+
+// DetectParser returns the parser for the era that the JSON event is from. If no parser
+// detects the event, a parser that tries the fields from every era is returned along
+// with false
+func DetectParser(data []byte) (EventParser, bool) {
+	registered := Parsers()
+	for _, parser := range registered {
+		if parser.Detect(data) {
+			return parser, true
+		}
+	}
+	return defaultParser, false
+}
+
+var defaultParser = &cascadeParser{}
+
+// eventsAPIParser parses the events api format used from 2015 onwards, where the repo
+// and actor are objects with both a name and an id
+type eventsAPIParser struct{}
+
+func (p *eventsAPIParser) Era() string {
+	return "2015"
+}
+
+func (p *eventsAPIParser) Detect(data []byte) bool {
+	_, dataType, _, err := jsonparser.Get(data, "repo")
+	return err == nil && dataType == jsonparser.Object
+}
+
+func (p *eventsAPIParser) ParseEvent(data []byte) *Event {
+	event := parseCommonFields(data)
+	event.RepoName, _ = jsonparser.GetString(data, "repo", "name")
+	event.RepoID = getInt(data, "repo", "id")
+
+	if user, err := jsonparser.GetString(data, "actor", "login"); err == nil {
+		event.UserName = user
+		event.UserID = getInt(data, "actor", "id")
+	} else {
+		event.UserName = "?"
+	}
+
+	if org, err := jsonparser.GetString(data, "org", "login"); err == nil {
+		event.OrgName = org
+		event.OrgID = getInt(data, "org", "id")
+	}
+	return event
+}
+
+func (p *eventsAPIParser) ParseForkEvent(repo string, data []byte) (int64, string) {
+	forkName, _ := jsonparser.GetString(data, "payload", "forkee", "full_name")
+	return getInt(data, "payload", "forkee", "id"), forkName
+}
+
+// timelineParser parses the timeline format used from 2011 to 2014, where the actor is
+// just a login and the repo is an object without its owner in the name. The eras are
+// split by year, since only the fork events changed
+type timelineParser struct {
+	era       string
+	firstYear int
+	lastYear  int
+	parseFork func(repo string, data []byte) (int64, string)
+}
+
+func (p *timelineParser) Era() string {
+	return p.era
+}
+
+func (p *timelineParser) Detect(data []byte) bool {
+	if _, _, _, err := jsonparser.Get(data, "repo"); err == nil {
+		return false
+	}
+
+	// created_at is either like 2012-03-10T22:15:37-08:00 or 2012/03/10 22:15:37 -0800
+	createdAt, err := jsonparser.GetString(data, "created_at")
+	if err != nil || len(createdAt) < 4 {
+		return false
+	}
+	year, err := strconv.Atoi(createdAt[:4])
+	return err == nil && year >= p.firstYear && year <= p.lastYear
+}
+
+func (p *timelineParser) ParseEvent(data []byte) *Event {
+	event := parseCommonFields(data)
+
+	if url, err := jsonparser.GetString(data, "repository", "url"); err == nil {
+		event.RepoName = repoFromURL(url)
+	} else {
+		event.RepoName, _ = jsonparser.GetString(data, "repository", "full_name")
+	}
+	event.RepoID = getInt(data, "repository", "id")
+
+	user, err := jsonparser.GetString(data, "actor")
+	if err != nil {
+		user = "?"
+	}
+	event.UserName = user
+
+	event.OrgName, _ = jsonparser.GetString(data, "repository", "organization")
+	return event
+}
+
+func (p *timelineParser) ParseForkEvent(repo string, data []byte) (int64, string) {
+	return p.parseFork(repo, data)
+}
+
+// 2013/2014: ForkEvent only stored in the url field, means no meaningful forkID =(
+func parseForkEvent2013(repo string, data []byte) (int64, string) {
+	url, _ := jsonparser.GetString(data, "url")
+	return getInt(data, "payload", "forkee", "id"), repoFromURL(url)
+}
+
+// 2012: forkID should already be set appropiately, forkName needs gotten from url
+func parseForkEvent2012(repo string, data []byte) (int64, string) {
+	url, _ := jsonparser.GetString(data, "payload", "forkee", "html_url")
+	return getInt(data, "payload", "forkee", "id"), repoFromURL(url)
+}
+
+// 2011: forkee is just the id, and the fork name is the repo name with the owner
+// swapped for the user that forked it
+func parseForkEvent2011(repo string, data []byte) (int64, string) {
+	forkID := getInt(data, "payload", "forkee")
+
+	forkName := ""
+	actor, err := jsonparser.GetString(data, "payload", "actor")
+	if err == nil && repo != "/" {
+		tokens := strings.Split(repo, "/")
+		tokens[0] = actor
+		forkName = strings.Join(tokens, "/")
+	}
+	return forkID, forkName
+}
+
+// cascadeParser handles the events that no era detects, like timeline events without a
+// readable created_at, by trying the fields from each era in turn
+type cascadeParser struct{}
+
+func (p *cascadeParser) Era() string {
+	return ""
+}
+
+func (p *cascadeParser) Detect(data []byte) bool {
+	return true
+}
+
+func (p *cascadeParser) ParseEvent(data []byte) *Event {
+	event := parseCommonFields(data)
+
+	if repo, err := jsonparser.GetString(data, "repo", "name"); err == nil {
+		event.RepoName = repo
+		event.RepoID = getInt(data, "repo", "id")
+	} else {
+		if url, err := jsonparser.GetString(data, "repository", "url"); err == nil {
+			event.RepoName = repoFromURL(url)
+		} else {
+			event.RepoName, _ = jsonparser.GetString(data, "repository", "full_name")
+		}
+		event.RepoID = getInt(data, "repository", "id")
+	}
+
+	if user, err := jsonparser.GetString(data, "actor", "login"); err == nil {
+		event.UserName = user
+		event.UserID = getInt(data, "actor", "id")
+	} else if user, err := jsonparser.GetString(data, "actor"); err == nil {
+		event.UserName = user
+	} else {
+		event.UserName = "?"
+	}
+
+	if org, err := jsonparser.GetString(data, "org", "login"); err == nil {
+		event.OrgName = org
+		event.OrgID = getInt(data, "org", "id")
+	} else {
+		event.OrgName, _ = jsonparser.GetString(data, "repository", "organization")
+	}
+	return event
+}
+
+func (p *cascadeParser) ParseForkEvent(repo string, data []byte) (int64, string) {
+	return parseForkCascade(repo, data)
+}
+
+// parseForkCascade returns the fork from the fields used by each era in turn, for fork
+// events whose era couldn't be detected
+func parseForkCascade(repo string, data []byte) (int64, string) {
+	forkID := getInt(data, "payload", "forkee", "id")
+	if forkName, err := jsonparser.GetString(data, "payload", "forkee", "full_name"); err == nil {
+		return forkID, forkName
+	}
+
+	// 2013/2014: ForkEvent only stored in the url field, means no meaningful forkID =(
+	if url, err := jsonparser.GetString(data, "url"); err == nil {
+		return forkID, repoFromURL(url)
+	}
+
+	// 2012: forkID should already be set appropiately, forkName needs gotten from url
+	if url, err := jsonparser.GetString(data, "payload", "forkee", "html_url"); err == nil {
+		return forkID, repoFromURL(url)
+	}
+	if repo == "/" {
+		return forkID, ""
+	}
+
+	// 2011: forkee is just the id, and the fork name is the repo name with the owner
+	// swapped for the user that forked it
+	forkID, _ = jsonparser.GetInt(data, "payload", "forkee")
+	forkName := ""
+	if actor, err := jsonparser.GetString(data, "payload", "actor"); err == nil {
+		tokens := strings.Split(repo, "/")
+		tokens[0] = actor
+		forkName = strings.Join(tokens, "/")
+	}
+	return forkID, forkName
+}
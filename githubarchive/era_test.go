@@ -0,0 +1,76 @@
+package githubarchive
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// goldenEvent is an event from testdata/<era>/*.json, along with the Event that it should
+// parse to and optionally the typed payload from ParsePayload. Events in testdata/undetected
+// shouldn't be detected by any parser
+type goldenEvent struct {
+	Event    json.RawMessage `json:"event"`
+	Expected Event           `json:"expected"`
+	Payload  json.RawMessage `json:"payload"`
+}
+
+func loadGoldenEvents(t *testing.T) map[string]*goldenEvent {
+	filenames, err := filepath.Glob(filepath.Join("testdata", "*", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filenames) == 0 {
+		t.Fatal("No golden events found in testdata")
+	}
+
+	golden := make(map[string]*goldenEvent)
+	for _, filename := range filenames {
+		contents, err := ioutil.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var event goldenEvent
+		if err := json.Unmarshal(contents, &event); err != nil {
+			t.Fatalf("Failed to parse '%s': %s", filename, err.Error())
+		}
+		golden[filename] = &event
+	}
+	return golden
+}
+
+func TestParsersDetectGoldenEvents(t *testing.T) {
+	golden := loadGoldenEvents(t)
+	for _, parser := range Parsers() {
+		for filename, event := range golden {
+			era := filepath.Base(filepath.Dir(filename))
+			if detected := parser.Detect(event.Event); detected != (era == parser.Era()) {
+				t.Errorf("Parser for era '%s' returned %t from Detect for '%s'", parser.Era(), detected, filename)
+			}
+		}
+	}
+}
+
+func TestParseGoldenEvents(t *testing.T) {
+	for filename, golden := range loadGoldenEvents(t) {
+		parser, ok := DetectParser(golden.Event)
+		era := filepath.Base(filepath.Dir(filename))
+		if era == "undetected" {
+			if ok {
+				t.Errorf("Expected '%s' to be undetected, got era '%s'", filename, parser.Era())
+			}
+		} else if !ok || parser.Era() != era {
+			t.Errorf("Expected '%s' to be detected as era '%s', got '%s'", filename, era, parser.Era())
+		}
+
+		event := ParseEvent(golden.Event)
+		if event.Type == "ForkEvent" {
+			event.ForkID, event.ForkName = ParseForkEvent(event.RepoName, golden.Event)
+		}
+		if !reflect.DeepEqual(*event, golden.Expected) {
+			t.Errorf("Parsing '%s'\ngot:      %+v\nexpected: %+v", filename, *event, golden.Expected)
+		}
+	}
+}
@@ -2,13 +2,17 @@ package githubarchive
 
 import (
 	"strings"
+	"time"
 
 	"github.com/buger/jsonparser"
 )
 
 // Event holds parsed data about a single event from the Github Archive
 type Event struct {
+	// ID is the id of the event, which is only available for events from 2015 onwards
+	ID           string
 	Type         string
+	Public       bool
 	RepoID       int64
 	RepoName     string
 	RepoLanguage string
@@ -16,7 +20,24 @@ type Event struct {
 	UserName     string
 	ForkID       int64
 	ForkName     string
-	CreatedAt    string
+
+	// CreatedAt is the created_at timestamp as it appears in the archive, and Time is
+	// the parsed version normalized to UTC (or the zero time if it couldn't be parsed)
+	CreatedAt string
+	Time      time.Time
+
+	// OrgName is the organization that owns the repo, OrgID is only available from
+	// 2015 onwards and is -1 before then
+	OrgID   int64
+	OrgName string
+
+	// Era is the era of the EventParser that parsed the event, like "2015", and is
+	// empty if the era couldn't be detected
+	Era string
+
+	// Hour is the githubarchive hour that the event was read from, when read
+	// through a RangeScanner
+	Hour time.Time
 }
 
 func repoFromURL(url string) string {
@@ -27,93 +48,113 @@ func repoFromURL(url string) string {
 	return url
 }
 
+// createdAtFormats are the formats that created_at has used over the years
+var createdAtFormats = []string{time.RFC3339, "2006/01/02 15:04:05 -0700"}
+
+// parseCreatedAt parses the created_at timestamp of an event
+func parseCreatedAt(value string) (time.Time, error) {
+	var err error
+	for _, format := range createdAtFormats {
+		var t time.Time
+		if t, err = time.Parse(format, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
+
 // ParseEvent parses the JSON and returns a new Event struct. The JSON
 // can be from multiple different formats produced by github over the
-// years
+// years, and is parsed by the EventParser for the era it's from
 func ParseEvent(data []byte) *Event {
-	// TODO int64 -> int?
-	var repoID int64 = -1
-	var userID int64 = -1
-
-	// This is slightly complciated since we're trying to extract multiple
-	// different JSON formats
-	// TODO: jsonparser.EachKey api might be faster?
-	eventType, _ := jsonparser.GetString(data, "type")
-
-	created_at, _ := jsonparser.GetString(data, "created_at")
-
-	repo, err := jsonparser.GetString(data, "repo", "name")
-	if err != nil {
-		repourl, err := jsonparser.GetString(data, "repository", "url")
-		if err == nil {
-			repo = repoFromURL(repourl)
-		} else {
-			repo, err = jsonparser.GetString(data, "repository", "full_name")
-		}
+	event, _ := parseEvent(data)
+	return event
+}
 
-		repoID, err = jsonparser.GetInt(data, "repository", "id")
-		if err != nil {
-			repoID = -1
-		}
-	} else {
-		repoID, err = jsonparser.GetInt(data, "repo", "id")
-		if err != nil {
-			repoID = -1
-		}
+// parseEvent parses the event, returning whether the era of the event was detected
+func parseEvent(data []byte) (*Event, bool) {
+	parser, ok := DetectParser(data)
+	event := parser.ParseEvent(data)
+	if ok {
+		event.Era = parser.Era()
 	}
+	return event, ok
+}
 
-	user, err := jsonparser.GetString(data, "actor", "login")
-	if err != nil {
-		user, err = jsonparser.GetString(data, "actor")
-		if err != nil {
-			user = "?"
-		}
-	} else {
-		userID, err = jsonparser.GetInt(data, "actor", "id")
-		if err != nil {
-			userID = -1
-		}
+// IsBot returns if the login of the actor looks like a bot. This isn't computed by
+// ParseEvent since most callers don't need it, see BotClassifier for a more thorough
+// check that also uses the account type and activity
+func (e *Event) IsBot() bool {
+	return IsBotLogin(e.UserName)
+}
+
+// parseCommonFields parses the fields that are stored the same way in every era
+func parseCommonFields(data []byte) *Event {
+	event := &Event{RepoID: -1, UserID: -1, OrgID: -1}
+	event.ID, _ = jsonparser.GetString(data, "id")
+	event.Type, _ = jsonparser.GetString(data, "type")
+
+	event.CreatedAt, _ = jsonparser.GetString(data, "created_at")
+	if created, err := parseCreatedAt(event.CreatedAt); err == nil {
+		event.Time = created.UTC()
 	}
 
+	// private events aren't included in the archive, so treat a missing flag as public
+	public, err := jsonparser.GetBoolean(data, "public")
+	event.Public = public || err != nil
+
 	language, err := jsonparser.GetString(data, "repository", "language")
-	if err != nil && (eventType == "PullRequestEvent") {
+	if err != nil && event.Type == "PullRequestEvent" {
 		language, _ = jsonparser.GetString(data, "payload", "pull_request", "base", "repo", "language")
 	}
-
-	return &Event{Type: eventType, RepoName: repo, RepoID: repoID, RepoLanguage: language,
-		UserName: user, UserID: userID, CreatedAt: created_at}
+	event.RepoLanguage = language
+	return event
 }
 
 // ParseForkEvent returns the forked repo name and forked repo id from a JSON githubarchive event
 func ParseForkEvent(repo string, data []byte) (int64, string) {
-	forkID, err := jsonparser.GetInt(data, "payload", "forkee", "id")
-	if err != nil {
-		forkID = -1
+	parser, _ := DetectParser(data)
+	return parser.ParseForkEvent(repo, data)
+}
+
+// ParseWarning describes data that ParseEvent couldn't find in an event, and filled in
+// with a default value instead
+type ParseWarning string
+
+// Warnings returned by ParseEventWarnings
+const (
+	WarningMissingType   ParseWarning = "missing_type"
+	WarningUnknownSchema ParseWarning = "unknown_schema"
+	WarningMissingActor  ParseWarning = "missing_actor"
+	WarningMissingRepo   ParseWarning = "missing_repo"
+	WarningMissingRepoID ParseWarning = "missing_repo_id"
+	WarningBadTimestamp  ParseWarning = "bad_timestamp"
+)
+
+// ParseEventWarnings is like ParseEvent, but also returns warnings for the fields that
+// couldn't be parsed. ParseEvent is faster when the warnings aren't needed
+func ParseEventWarnings(data []byte) (*Event, []ParseWarning) {
+	event, detected := parseEvent(data)
+
+	var warnings []ParseWarning
+	if event.Type == "" {
+		warnings = append(warnings, WarningMissingType)
 	}
-	forkName, err := jsonparser.GetString(data, "payload", "forkee", "full_name")
-	if err != nil {
-		// 2013/2014: ForkEvent only stored in the url field, means no meaningful forkID =(
-		url, err := jsonparser.GetString(data, "url")
-		if err == nil {
-			forkName = repoFromURL(url)
-		} else {
-			// 2012: forkID should already be set appropiately, forkName needs gotten from url
-			url, err := jsonparser.GetString(data, "payload", "forkee", "html_url")
-			if err == nil {
-				forkName = repoFromURL(url)
-			} else if repo != "/" {
-				// 2011
-				forkID, _ = jsonparser.GetInt(data, "payload", "forkee")
-				// get the user that forked the repo, and swap into the repo name
-				actor, err := jsonparser.GetString(data, "payload", "actor")
-				if err == nil {
-					tokens := strings.Split(repo, "/")
-					tokens[0] = actor
-					forkName = strings.Join(tokens, "/")
-				}
-			}
-		}
+	if !detected {
+		warnings = append(warnings, WarningUnknownSchema)
+	} else if _, dataType, _, err := jsonparser.Get(data, "payload"); err != nil || dataType != jsonparser.Object {
+		warnings = append(warnings, WarningUnknownSchema)
 	}
-
-	return forkID, forkName
+	if event.UserName == "?" {
+		warnings = append(warnings, WarningMissingActor)
+	}
+	if event.RepoName == "" {
+		warnings = append(warnings, WarningMissingRepo)
+	} else if event.RepoID == -1 {
+		warnings = append(warnings, WarningMissingRepoID)
+	}
+	if event.Time.IsZero() {
+		warnings = append(warnings, WarningBadTimestamp)
+	}
+	return event, warnings
 }
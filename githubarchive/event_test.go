@@ -0,0 +1,25 @@
+package githubarchive
+
+import "testing"
+
+var benchmarkEvent = []byte(`{"id":"2489651045","type":"PushEvent","actor":{"id":583231,"login":"octocat"},` +
+	`"repo":{"id":1296269,"name":"octocat/hello-world"},"payload":{"push_id":536863970,"size":1,"distinct_size":1,` +
+	`"ref":"refs/heads/master","commits":[{"sha":"6dcb09b5b57875f334f61aebed695e2e4193db5e",` +
+	`"author":{"email":"octocat@github.com","name":"Monalisa Octocat"},"message":"Fix all the bugs","distinct":true}]},` +
+	`"public":true,"created_at":"2015-01-01T15:00:00Z"}`)
+
+func BenchmarkParseEvent(b *testing.B) {
+	b.SetBytes(int64(len(benchmarkEvent)))
+	for i := 0; i < b.N; i++ {
+		ParseEvent(benchmarkEvent)
+	}
+}
+
+func BenchmarkParseEventWarnings(b *testing.B) {
+	b.SetBytes(int64(len(benchmarkEvent)))
+	for i := 0; i < b.N; i++ {
+		if _, warnings := ParseEventWarnings(benchmarkEvent); len(warnings) > 0 {
+			b.Fatalf("Unexpected warnings %v", warnings)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package githubarchive
+
+import (
+	"bytes"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/buger/jsonparser"
+)
+
+// Filter selects the events returned by a scanner. Each field that is set has to match
+// for an event to be returned, and empty fields match everything. Lines are checked
+// against the raw bytes first, so that most events can be rejected without parsing
+type Filter struct {
+	Types     []string
+	RepoNames []string
+	RepoIDs   []int64
+	Actors    []string
+
+	// Start and End restrict the events to those created in [Start, End)
+	Start time.Time
+	End   time.Time
+
+	// ExcludeBots drops events from actors whose login looks like a bot
+	ExcludeBots bool
+
+	once      sync.Once
+	types     map[string]bool
+	repoNames map[string]bool
+	repoIDs   map[int64]bool
+	actors    map[string]bool
+
+	// byte patterns for the raw prefilter
+	typePatterns     [][]byte
+	repoNamePatterns [][]byte
+	repoIDPatterns   [][]byte
+	actorPatterns    [][]byte
+}
+
+func (f *Filter) compile() {
+	f.types = make(map[string]bool)
+	for _, t := range f.Types {
+		f.types[t] = true
+		f.typePatterns = append(f.typePatterns, []byte(strconv.Quote(t)))
+	}
+
+	// the prefilter only needs one of the repos or actors to appear somewhere in
+	// the line, the full check is done on the parsed event. Older events only have
+	// the repo name as part of a url, which might have its slashes escaped
+	f.repoNames = make(map[string]bool)
+	for _, name := range f.RepoNames {
+		f.repoNames[name] = true
+		f.repoNamePatterns = append(f.repoNamePatterns, []byte(name),
+			bytes.Replace([]byte(name), []byte("/"), []byte("\\/"), -1))
+	}
+	f.repoIDs = make(map[int64]bool)
+	for _, id := range f.RepoIDs {
+		f.repoIDs[id] = true
+		f.repoIDPatterns = append(f.repoIDPatterns, []byte(strconv.FormatInt(id, 10)))
+	}
+	f.actors = make(map[string]bool)
+	for _, actor := range f.Actors {
+		f.actors[actor] = true
+		f.actorPatterns = append(f.actorPatterns, []byte(actor))
+	}
+}
+
+func containsAny(line []byte, patterns [][]byte) bool {
+	for _, pattern := range patterns {
+		if bytes.Contains(line, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match returns if the raw JSON of an event passes the filter. A nil filter matches
+// every event
+func (f *Filter) Match(line []byte) bool {
+	matched, _ := f.match(line)
+	return matched
+}
+
+// match returns if the line passes the filter, along with the parsed event if the
+// filter needed to parse it
+func (f *Filter) match(line []byte) (bool, *Event) {
+	if f == nil {
+		return true, nil
+	}
+	f.once.Do(f.compile)
+
+	if len(f.types) > 0 {
+		if !containsAny(line, f.typePatterns) {
+			return false, nil
+		}
+		eventType, _ := jsonparser.GetString(line, "type")
+		if !f.types[eventType] {
+			return false, nil
+		}
+	}
+
+	if !f.Start.IsZero() || !f.End.IsZero() {
+		createdAt, _ := jsonparser.GetString(line, "created_at")
+		created, err := parseCreatedAt(createdAt)
+		if err != nil || created.Before(f.Start) || (!f.End.IsZero() && !created.Before(f.End)) {
+			return false, nil
+		}
+	}
+
+	if len(f.repoNames) == 0 && len(f.repoIDs) == 0 && len(f.actors) == 0 && !f.ExcludeBots {
+		return true, nil
+	}
+
+	if len(f.repoNames) > 0 && !containsAny(line, f.repoNamePatterns) {
+		return false, nil
+	}
+	if len(f.repoIDs) > 0 && !containsAny(line, f.repoIDPatterns) {
+		return false, nil
+	}
+	if len(f.actors) > 0 && !containsAny(line, f.actorPatterns) {
+		return false, nil
+	}
+
+	event := ParseEvent(line)
+	if len(f.repoNames) > 0 && !f.repoNames[event.RepoName] {
+		return false, event
+	}
+	if len(f.repoIDs) > 0 && !f.repoIDs[event.RepoID] {
+		return false, event
+	}
+	if len(f.actors) > 0 && !f.actors[event.UserName] {
+		return false, event
+	}
+	if f.ExcludeBots && event.IsBot() {
+		return false, event
+	}
+	return true, event
+}
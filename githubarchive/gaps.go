@@ -0,0 +1,172 @@
+package githubarchive
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+)
+
+// HourFile is a githubarchive file on disk for a single hour
+type HourFile struct {
+	Hour time.Time `json:"hour"`
+	Size int64     `json:"size"`
+}
+
+// StaleDay is a day whose parsed_events.tsv file needs to be regenerated
+type StaleDay struct {
+	Day    time.Time `json:"day"`
+	Reason string    `json:"reason"`
+}
+
+// GapReport lists the problems found comparing a githubarchive directory against
+// the expected hourly calendar
+type GapReport struct {
+	Start      time.Time   `json:"start"`
+	End        time.Time   `json:"end"`
+	Missing    []time.Time `json:"missing"`
+	KnownGaps  []time.Time `json:"known_gaps"`
+	Undersized []HourFile  `json:"undersized"`
+	StaleDays  []StaleDay  `json:"stale_days"`
+}
+
+// HasGaps returns whether any problems were found. Known outages aren't counted
+func (r *GapReport) HasGaps() bool {
+	return len(r.Missing) > 0 || len(r.Undersized) > 0 || len(r.StaleDays) > 0
+}
+
+// Print writes out a human readable version of the report
+func (r *GapReport) Print(w io.Writer) {
+	fmt.Fprintf(w, "Checked %s to %s: %d missing hours, %d known gaps, %d undersized hours, %d stale days\n",
+		r.Start.Format(hourFormat), r.End.Format(hourFormat), len(r.Missing), len(r.KnownGaps),
+		len(r.Undersized), len(r.StaleDays))
+	for _, hour := range r.Missing {
+		fmt.Fprintf(w, "  missing %s\n", hour.Format(hourFormat))
+	}
+	for _, hour := range r.KnownGaps {
+		fmt.Fprintf(w, "  known gap %s\n", hour.Format(hourFormat))
+	}
+	for _, file := range r.Undersized {
+		fmt.Fprintf(w, "  undersized %s: %d bytes\n", file.Hour.Format(hourFormat), file.Size)
+	}
+	for _, day := range r.StaleDays {
+		fmt.Fprintf(w, "  stale %s: %s\n", day.Day.Format("2006-01-02"), day.Reason)
+	}
+}
+
+// WriteJSON writes out the report as JSON
+func (r *GapReport) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// FindGaps checks every hour in [start, end) against the files in basedir, reporting
+// hours that are missing or smaller than minSize bytes, and days where the
+// parsed_events.tsv file is missing or older than the hour files it was built from.
+// Missing hours that are in the outages calendar are reported as known gaps instead
+func FindGaps(basedir string, layout Layout, start time.Time, end time.Time, minSize int64,
+	outages *OutageCalendar) (*GapReport, error) {
+	start = start.UTC().Truncate(time.Hour)
+	end = end.UTC().Truncate(time.Hour)
+	report := &GapReport{Start: start, End: end}
+	files := make(dirCache)
+
+	for day := start.Truncate(24 * time.Hour); day.Before(end); day = day.AddDate(0, 0, 1) {
+		var newest time.Time
+		for hour := day; hour.Before(day.AddDate(0, 0, 1)); hour = hour.Add(time.Hour) {
+			file, err := files.stat(path.Join(basedir, layout.HourPath(hour)))
+			if err != nil {
+				return nil, err
+			}
+			if file != nil && file.ModTime().After(newest) {
+				newest = file.ModTime()
+			}
+
+			if hour.Before(start) || !hour.Before(end) {
+				continue
+			}
+
+			if file == nil && outages.IsKnownOutage(hour) {
+				report.KnownGaps = append(report.KnownGaps, hour)
+			} else if file == nil {
+				report.Missing = append(report.Missing, hour)
+			} else if file.Size() < minSize {
+				report.Undersized = append(report.Undersized, HourFile{hour, file.Size()})
+			}
+		}
+
+		if newest.IsZero() {
+			continue
+		}
+
+		parsed, err := files.stat(path.Join(basedir, layout.DayFilePath(day, "parsed_events.tsv")))
+		if err != nil {
+			return nil, err
+		}
+		if parsed == nil {
+			report.StaleDays = append(report.StaleDays, StaleDay{day, "parsed_events.tsv is missing"})
+		} else if parsed.ModTime().Before(newest) {
+			report.StaleDays = append(report.StaleDays, StaleDay{day, "parsed_events.tsv is older than the hour files"})
+		}
+	}
+
+	return report, nil
+}
+
+// FirstMissingHour returns the oldest hour in [start, end) that isn't on disk and isn't a
+// known outage, which is where an incremental download should resume from so that holes
+// left by failed or interrupted downloads are retried. Returns end if nothing is missing
+func FirstMissingHour(basedir string, layout Layout, start time.Time, end time.Time,
+	outages *OutageCalendar) (time.Time, error) {
+	report, err := FindGaps(basedir, layout, start, end, 0, outages)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(report.Missing) == 0 {
+		return report.End, nil
+	}
+	return report.Missing[0], nil
+}
+
+// dirCache lists directories on demand, so that checking many files in the same
+// directory only needs a single ReadDir
+type dirCache map[string]map[string]os.FileInfo
+
+// stat returns the file info for filename, or nil if the file doesn't exist
+func (c dirCache) stat(filename string) (os.FileInfo, error) {
+	dir := path.Dir(filename)
+	files, ok := c[dir]
+	if !ok {
+		entries, err := readDirFiles(dir)
+		if err != nil {
+			return nil, err
+		}
+		files = entries
+		c[dir] = files
+	}
+	return files[path.Base(filename)], nil
+}
+
+// readDirFiles returns the files in a directory by name, or nothing if the
+// directory doesn't exist
+func readDirFiles(dir string) (map[string]os.FileInfo, error) {
+	files := make(map[string]os.FileInfo)
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return files, nil
+		}
+		return nil, fmt.Errorf("Failed to read '%s': %s", dir, err.Error())
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			files[entry.Name()] = entry
+		}
+	}
+	return files, nil
+}
@@ -0,0 +1,45 @@
+package githubarchive
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestFirstMissingHour(t *testing.T) {
+	basedir, err := ioutil.TempDir("", "githubarchive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(basedir)
+
+	start, end := testHour, testHour.Add(4*time.Hour)
+	check := func(expected time.Time) {
+		t.Helper()
+		first, err := FirstMissingHour(basedir, FlatLayout, start, end, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !first.Equal(expected) {
+			t.Errorf("Expected first missing hour to be %s, got %s", expected, first)
+		}
+	}
+
+	// an empty tree starts from the beginning of the range
+	check(start)
+
+	// a hole below the newest file is where the download resumes from
+	for _, hour := range []time.Time{start, start.Add(2 * time.Hour), start.Add(3 * time.Hour)} {
+		if err := ioutil.WriteFile(path.Join(basedir, FlatLayout.HourPath(hour)), gzipLines(t, "{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check(start.Add(time.Hour))
+
+	if err := ioutil.WriteFile(path.Join(basedir, FlatLayout.HourPath(start.Add(time.Hour))), gzipLines(t, "{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	check(end)
+}
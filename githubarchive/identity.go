@@ -0,0 +1,216 @@
+package githubarchive
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NameSpan is a name that an id was seen with, and the first and last time it was seen
+type NameSpan struct {
+	ID    int64
+	Name  string
+	First time.Time
+	Last  time.Time
+}
+
+// IdentityResolver builds up the history of names for each repo (or user) id over time,
+// so that renamed repos can be mapped to a single canonical name, and the events that
+// only have a name can have their id filled in
+type IdentityResolver struct {
+	mutex sync.RWMutex
+
+	// spans by id and by lowercased name, since github names are case insensitive
+	ids   map[int64][]*NameSpan
+	names map[string][]*NameSpan
+}
+
+// NewIdentityResolver returns an empty resolver
+func NewIdentityResolver() *IdentityResolver {
+	return &IdentityResolver{ids: make(map[int64][]*NameSpan), names: make(map[string][]*NameSpan)}
+}
+
+// Observe records that id had name at a point in time. Unknown ids (-1) and names are
+// ignored
+func (r *IdentityResolver) Observe(id int64, name string, at time.Time) {
+	r.observeSpan(id, name, at, at)
+}
+
+func (r *IdentityResolver) observeSpan(id int64, name string, first time.Time, last time.Time) {
+	if id <= 0 || name == "" || name == "/" || name == "?" {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for _, span := range r.ids[id] {
+		if span.Name == name {
+			if first.Before(span.First) {
+				span.First = first
+			}
+			if last.After(span.Last) {
+				span.Last = last
+			}
+			return
+		}
+	}
+
+	span := &NameSpan{ID: id, Name: name, First: first, Last: last}
+	r.ids[id] = append(r.ids[id], span)
+	key := strings.ToLower(name)
+	r.names[key] = append(r.names[key], span)
+}
+
+// History returns the names that id has had, sorted by when they were first seen
+func (r *IdentityResolver) History(id int64) []NameSpan {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	history := make([]NameSpan, 0, len(r.ids[id]))
+	for _, span := range r.ids[id] {
+		history = append(history, *span)
+	}
+	sort.Slice(history, func(i, j int) bool { return history[i].First.Before(history[j].First) })
+	return history
+}
+
+// CanonicalName returns the most recently seen name for id
+func (r *IdentityResolver) CanonicalName(id int64) (string, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var latest *NameSpan
+	for _, span := range r.ids[id] {
+		if latest == nil || span.Last.After(latest.Last) {
+			latest = span
+		}
+	}
+	if latest == nil {
+		return "", false
+	}
+	return latest.Name, true
+}
+
+// ResolveID returns the id that name referred to at a point in time. Since names can
+// be reused after a rename or a delete, this picks the id whose span contains the time,
+// or failing that the span closest to it
+func (r *IdentityResolver) ResolveID(name string, at time.Time) (int64, bool) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	var best *NameSpan
+	var bestDistance time.Duration
+	for _, span := range r.names[strings.ToLower(name)] {
+		var distance time.Duration
+		if at.Before(span.First) {
+			distance = span.First.Sub(at)
+		} else if at.After(span.Last) {
+			distance = at.Sub(span.Last)
+		}
+		if best == nil || distance < bestDistance {
+			best, bestDistance = span, distance
+		}
+	}
+	if best == nil {
+		return -1, false
+	}
+	return best.ID, true
+}
+
+// Save writes out every span, as 'id name first last canonical' tab separated lines.
+// The canonical name is only there for the shell scripts, and is ignored by Load
+func (r *IdentityResolver) Save(w io.Writer) error {
+	r.mutex.RLock()
+	ids := make([]int64, 0, len(r.ids))
+	for id := range r.ids {
+		ids = append(ids, id)
+	}
+	r.mutex.RUnlock()
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	out := bufio.NewWriter(w)
+	for _, id := range ids {
+		canonical, _ := r.CanonicalName(id)
+		for _, span := range r.History(id) {
+			fmt.Fprintf(out, "%d\t%s\t%s\t%s\t%s\n", span.ID, span.Name,
+				span.First.Format(time.RFC3339), span.Last.Format(time.RFC3339), canonical)
+		}
+	}
+	return out.Flush()
+}
+
+// Load reads spans written by Save, merging them into the resolver
+func (r *IdentityResolver) Load(reader io.Reader) error {
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if len(fields) < 4 {
+			return fmt.Errorf("Failed to parse identity '%s'", scanner.Text())
+		}
+
+		id, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return fmt.Errorf("Failed to parse identity '%s': %s", scanner.Text(), err.Error())
+		}
+		first, err := time.Parse(time.RFC3339, fields[2])
+		if err != nil {
+			return fmt.Errorf("Failed to parse identity '%s': %s", scanner.Text(), err.Error())
+		}
+		last, err := time.Parse(time.RFC3339, fields[3])
+		if err != nil {
+			return fmt.Errorf("Failed to parse identity '%s': %s", scanner.Text(), err.Error())
+		}
+		r.observeSpan(id, fields[1], first, last)
+	}
+	return scanner.Err()
+}
+
+// Identities resolves both the repos and the users in events
+type Identities struct {
+	Repos *IdentityResolver
+	Users *IdentityResolver
+}
+
+// NewIdentities returns empty repo and user resolvers
+func NewIdentities() *Identities {
+	return &Identities{Repos: NewIdentityResolver(), Users: NewIdentityResolver()}
+}
+
+// Observe records the repo and user names and ids from an event
+func (ids *Identities) Observe(event *Event) {
+	ids.Repos.Observe(event.RepoID, event.RepoName, event.Time)
+	ids.Users.Observe(event.UserID, event.UserName, event.Time)
+}
+
+// Backfill fills in the repo and user ids of an event that only had names, and replaces
+// the repo name with its canonical name so that renamed repos are grouped together.
+// Returns if anything was changed
+func (ids *Identities) Backfill(event *Event) bool {
+	changed := false
+	if event.RepoID == -1 && event.RepoName != "" {
+		if id, ok := ids.Repos.ResolveID(event.RepoName, event.Time); ok {
+			event.RepoID = id
+			changed = true
+		}
+	}
+	if event.RepoID != -1 {
+		if name, ok := ids.Repos.CanonicalName(event.RepoID); ok && name != event.RepoName {
+			event.RepoName = name
+			changed = true
+		}
+	}
+
+	if event.UserID == -1 && event.UserName != "" {
+		if id, ok := ids.Users.ResolveID(event.UserName, event.Time); ok {
+			event.UserID = id
+			changed = true
+		}
+	}
+	return changed
+}
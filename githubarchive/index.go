@@ -0,0 +1,174 @@
+package githubarchive
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/buger/jsonparser"
+)
+
+// indexFilename returns the name of the sidecar index for an hour file
+func indexFilename(filename string) string {
+	return filename + ".idx"
+}
+
+// EventIndex maps the ids of the events in an hour file to the offset of each event
+// in the uncompressed file
+type EventIndex map[string]int64
+
+// BuildIndex scans an hour file, recording the offset of every event. Events from
+// before 2015 don't have ids, and aren't included in the index
+func BuildIndex(ctx context.Context, filename string) (EventIndex, error) {
+	it, err := NewScannerContext(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+	defer it.Close()
+
+	index := make(EventIndex)
+	for it.Scan() {
+		if id, err := jsonparser.GetString(it.Bytes(), "id"); err == nil {
+			index[id] = it.Offset()
+		}
+	}
+	if err := it.Err(); err != nil {
+		return nil, fmt.Errorf("Failed to index '%s': %s", filename, err.Error())
+	}
+	return index, nil
+}
+
+// LoadIndex reads the sidecar index for an hour file
+func LoadIndex(filename string) (EventIndex, error) {
+	f, err := os.Open(indexFilename(filename))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	index := make(EventIndex)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("Failed to parse index '%s': invalid line '%s'", f.Name(), scanner.Text())
+		}
+		offset, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse index '%s': %s", f.Name(), err.Error())
+		}
+		index[fields[0]] = offset
+	}
+	return index, scanner.Err()
+}
+
+// Save writes the index as the sidecar for an hour file, with one 'id offset' line per
+// event in file order
+func (index EventIndex) Save(filename string) error {
+	ids := make([]string, 0, len(index))
+	for id := range index {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return index[ids[i]] < index[ids[j]] })
+
+	var contents bytes.Buffer
+	for _, id := range ids {
+		fmt.Fprintf(&contents, "%s %d\n", id, index[id])
+	}
+
+	target := indexFilename(filename)
+	f, err := ioutil.TempFile(path.Dir(target), "."+path.Base(target)+".")
+	if err != nil {
+		return err
+	}
+	if err = f.Chmod(0644); err == nil {
+		_, err = f.Write(contents.Bytes())
+	}
+	if err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), target)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// ReadEventAt returns the raw JSON of the event starting at offset in the uncompressed
+// hour file. Since the files are compressed this still has to decompress everything
+// before the offset, but skips parsing it
+func ReadEventAt(ctx context.Context, filename string, offset int64) ([]byte, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	reader, closer, err := decompress(f)
+	if err != nil {
+		return nil, err
+	}
+	if closer != nil {
+		defer closer.Close()
+	}
+
+	r := newContextReader(ctx, ioutil.NopCloser(reader))
+	if _, err := io.CopyN(ioutil.Discard, r, offset); err != nil {
+		return nil, fmt.Errorf("Failed to seek to offset %d in '%s': %s", offset, filename, err.Error())
+	}
+
+	line, err := bufio.NewReader(r).ReadBytes('\n')
+	if err != nil && (err != io.EOF || len(line) == 0) {
+		return nil, fmt.Errorf("Failed to read offset %d in '%s': %s", offset, filename, err.Error())
+	}
+	return line, nil
+}
+
+// LookupEvent returns the raw JSON of the event with id in an hour file. The sidecar
+// index is built and saved if it doesn't exist yet or is older than the hour file
+func LookupEvent(ctx context.Context, filename string, id string) ([]byte, error) {
+	index, err := loadFreshIndex(filename)
+	if err != nil {
+		if index, err = BuildIndex(ctx, filename); err != nil {
+			return nil, err
+		}
+		if err := index.Save(filename); err != nil {
+			fmt.Printf("Failed to save index for '%s': %s\n", filename, err.Error())
+		}
+	}
+
+	offset, ok := index[id]
+	if !ok {
+		return nil, fmt.Errorf("Failed to find event '%s' in '%s'", id, filename)
+	}
+	return ReadEventAt(ctx, filename, offset)
+}
+
+// loadFreshIndex loads the sidecar index for an hour file, returning an error if it
+// doesn't exist or the hour file has been modified since it was written
+func loadFreshIndex(filename string) (EventIndex, error) {
+	hourStat, err := os.Stat(filename)
+	if err != nil {
+		return nil, err
+	}
+	indexStat, err := os.Stat(indexFilename(filename))
+	if err != nil {
+		return nil, err
+	}
+	if indexStat.ModTime().Before(hourStat.ModTime()) {
+		return nil, fmt.Errorf("Index for '%s' is out of date", filename)
+	}
+	return LoadIndex(filename)
+}
@@ -0,0 +1,252 @@
+package githubarchive
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Layout maps hours to filenames inside a directory of githubarchive files
+type Layout interface {
+	// Name identifies the layout, as used in the config file
+	Name() string
+
+	// HourPath returns the location of the file for an hour, relative to the base directory
+	HourPath(hour time.Time) string
+
+	// DayFilePath returns the location of a per day file (like parsed_events.tsv), relative
+	// to the base directory
+	DayFilePath(day time.Time, name string) string
+
+	// ParseHourPath returns the hour for a relative path, or an error if the path isn't
+	// the file for an hour in this layout
+	ParseHourPath(relpath string) (time.Time, error)
+}
+
+// NestedLayout stores files like 2015/01/02/15.json.gz, with per day files stored in
+// the day directory. This is what the analysis scripts expect
+var NestedLayout Layout = nestedLayout{}
+
+// FlatLayout stores files using the githubarchive naming like 2015-01-02-15.json.gz,
+// all in the same directory
+var FlatLayout Layout = flatLayout{}
+
+// ParseLayout returns the layout with the given name, defaulting to NestedLayout if
+// the name is empty
+func ParseLayout(name string) (Layout, error) {
+	switch name {
+	case "", NestedLayout.Name():
+		return NestedLayout, nil
+	case FlatLayout.Name():
+		return FlatLayout, nil
+	}
+	return nil, fmt.Errorf("Unknown layout '%s'", name)
+}
+
+type nestedLayout struct{}
+
+func (nestedLayout) Name() string {
+	return "nested"
+}
+
+func (nestedLayout) HourPath(hour time.Time) string {
+	return path.Join(nestedDayPath(hour), fmt.Sprintf("%d.json.gz", hour.Hour()))
+}
+
+func (nestedLayout) DayFilePath(day time.Time, name string) string {
+	return path.Join(nestedDayPath(day), name)
+}
+
+func (nestedLayout) ParseHourPath(relpath string) (time.Time, error) {
+	day, err := ParseDayPath(path.Dir(relpath))
+	if err != nil || strings.Count(path.Clean(relpath), "/") != 3 {
+		return time.Time{}, fmt.Errorf("Invalid githubarchive path '%s'", relpath)
+	}
+
+	name := path.Base(relpath)
+	hour, err := strconv.Atoi(strings.TrimSuffix(name, ".json.gz"))
+	if err != nil || hour < 0 || hour > 23 || name != fmt.Sprintf("%d.json.gz", hour) {
+		return time.Time{}, fmt.Errorf("Invalid githubarchive path '%s'", relpath)
+	}
+	return day.Add(time.Duration(hour) * time.Hour), nil
+}
+
+// SplitDayPath returns the base directory and the day for the path of a day in a layout,
+// like /data/githubarchive/2015/01/02 in the nested layout or /data/githubarchive/2015-01-02
+// in the flat layout
+func SplitDayPath(daypath string, layout Layout) (string, time.Time, error) {
+	daypath = path.Clean(daypath)
+	if layout == FlatLayout {
+		day, err := time.Parse("2006-01-02", path.Base(daypath))
+		if err != nil {
+			return "", time.Time{}, fmt.Errorf("Failed to parse day from '%s': %s", daypath, err.Error())
+		}
+		return path.Dir(daypath), day, nil
+	}
+
+	day, err := ParseDayPath(daypath)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return path.Dir(path.Dir(path.Dir(daypath))), day, nil
+}
+
+// nestedDayPath returns the directory holding all the hourly files for a day
+func nestedDayPath(day time.Time) string {
+	return fmt.Sprintf("%04d/%02d/%02d", day.Year(), day.Month(), day.Day())
+}
+
+type flatLayout struct{}
+
+func (flatLayout) Name() string {
+	return "flat"
+}
+
+func (flatLayout) HourPath(hour time.Time) string {
+	return archiveFilename(hour)
+}
+
+func (flatLayout) DayFilePath(day time.Time, name string) string {
+	return fmt.Sprintf("%04d-%02d-%02d.%s", day.Year(), day.Month(), day.Day(), name)
+}
+
+func (flatLayout) ParseHourPath(relpath string) (time.Time, error) {
+	return parseArchiveFilename(relpath)
+}
+
+// ListHours returns every hour that has a file in basedir, sorted chronologically
+func ListHours(ctx context.Context, basedir string, layout Layout) ([]time.Time, error) {
+	var hours []time.Time
+	err := filepath.Walk(basedir, func(filename string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+
+		relpath, err := filepath.Rel(basedir, filename)
+		if err != nil {
+			return err
+		}
+		if hour, err := layout.ParseHourPath(filepath.ToSlash(relpath)); err == nil {
+			hours = append(hours, hour)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to list '%s': %s", basedir, err.Error())
+	}
+
+	sort.Slice(hours, func(i, j int) bool { return hours[i].Before(hours[j]) })
+	return hours, nil
+}
+
+// FindDays returns every day that has at least one hour file in basedir, sorted
+// chronologically. Unlike FindDayPaths this works with any layout
+func FindDays(ctx context.Context, basedir string, layout Layout) ([]time.Time, error) {
+	hours, err := ListHours(ctx, basedir, layout)
+	if err != nil {
+		return nil, err
+	}
+
+	var days []time.Time
+	for _, hour := range hours {
+		day := hour.Truncate(24 * time.Hour)
+		if len(days) == 0 || !days[len(days)-1].Equal(day) {
+			days = append(days, day)
+		}
+	}
+	return days, nil
+}
+
+// MigrateLayout moves every hour file in basedir from one layout to another, along with
+// the per day files produced by the analysis. Returns the number of hours moved
+func MigrateLayout(ctx context.Context, basedir string, from Layout, to Layout, dryrun bool) (int, error) {
+	hours, err := ListHours(ctx, basedir, from)
+	if err != nil {
+		return 0, err
+	}
+
+	move := func(src string, dst string) error {
+		src, dst = path.Join(basedir, src), path.Join(basedir, dst)
+		if dryrun {
+			fmt.Printf("dry-run: moving '%s' to '%s'\n", src, dst)
+			return nil
+		}
+		if _, err := os.Stat(dst); err == nil {
+			return fmt.Errorf("Failed to move '%s': '%s' already exists", src, dst)
+		}
+		if err := ensureDir(path.Dir(dst)); err != nil {
+			return err
+		}
+		return os.Rename(src, dst)
+	}
+
+	moved := 0
+	var lastDay time.Time
+	for _, hour := range hours {
+		if err := ctx.Err(); err != nil {
+			return moved, err
+		}
+
+		src := from.HourPath(hour)
+		if err := move(src, to.HourPath(hour)); err != nil {
+			return moved, err
+		}
+		for _, sidecar := range []func(string) string{versionFilename, indexFilename} {
+			if _, err := os.Stat(path.Join(basedir, sidecar(src))); err == nil {
+				if err := move(sidecar(src), sidecar(to.HourPath(hour))); err != nil {
+					return moved, err
+				}
+			}
+		}
+		moved++
+
+		if day := hour.Truncate(24 * time.Hour); !day.Equal(lastDay) {
+			lastDay = day
+			for _, name := range DayFiles {
+				src := from.DayFilePath(day, name)
+				if _, err := os.Stat(path.Join(basedir, src)); err == nil {
+					if err := move(src, to.DayFilePath(day, name)); err != nil {
+						return moved, err
+					}
+				}
+			}
+		}
+	}
+
+	if !dryrun {
+		removeEmptyDirs(basedir)
+	}
+	return moved, nil
+}
+
+// DayFiles are the per day files produced by the analysis tools, which need to be
+// moved along with the hours when migrating layouts
+var DayFiles = []string{"parsed_events.tsv", "parsed_events_resolved.tsv", "parsed_email.tsv", "parsed_pull_requests.tsv"}
+
+// removeEmptyDirs removes any empty directories below basedir
+func removeEmptyDirs(basedir string) {
+	var dirs []string
+	filepath.Walk(basedir, func(filename string, info os.FileInfo, err error) error {
+		if err == nil && info.IsDir() && filename != basedir {
+			dirs = append(dirs, filename)
+		}
+		return nil
+	})
+
+	// remove the deepest directories first, so that their parents can be removed too
+	for i := len(dirs) - 1; i >= 0; i-- {
+		os.Remove(dirs[i])
+	}
+}
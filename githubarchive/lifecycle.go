@@ -0,0 +1,114 @@
+package githubarchive
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// LifecycleEventTypes are the event types that LifecycleTracker looks at, for use
+// with a Filter
+var LifecycleEventTypes = []string{"CreateEvent", "ForkEvent", "PublicEvent"}
+
+// RepoLifecycle is the timeline of a repo as seen in the archive. Times that weren't
+// seen are left as the zero time. Deletions aren't included, since a DeleteEvent is only
+// ever for a branch or tag: deleted repos are found when the scraper gets a 404 instead
+type RepoLifecycle struct {
+	ID   int64
+	Name string
+
+	// Created is from the CreateEvent for the repository, or the ForkEvent that
+	// created it for forks
+	Created time.Time
+
+	// Public is when a private repo was open sourced
+	Public time.Time
+}
+
+// LifecycleTracker builds up the lifecycle of each repo from the create, fork and public
+// events in the archive
+type LifecycleTracker struct {
+	mutex sync.Mutex
+	repos map[int64]*RepoLifecycle
+}
+
+// NewLifecycleTracker returns an empty tracker
+func NewLifecycleTracker() *LifecycleTracker {
+	return &LifecycleTracker{repos: make(map[int64]*RepoLifecycle)}
+}
+
+func (t *LifecycleTracker) repo(id int64, name string) *RepoLifecycle {
+	repo := t.repos[id]
+	if repo == nil {
+		repo = &RepoLifecycle{ID: id}
+		t.repos[id] = repo
+	}
+	if name != "" {
+		repo.Name = name
+	}
+	return repo
+}
+
+// earliest returns the earlier of two times, ignoring zero times
+func earliest(current time.Time, at time.Time) time.Time {
+	if current.IsZero() || at.Before(current) {
+		return at
+	}
+	return current
+}
+
+// Observe updates the lifecycle of the repo in an event, given the parsed event and
+// its raw JSON. Events for other types or without a repo id are ignored
+func (t *LifecycleTracker) Observe(event *Event, data []byte) {
+	if event.Time.IsZero() {
+		return
+	}
+
+	switch event.Type {
+	case "CreateEvent":
+		payload, err := ParsePayload(data)
+		if err != nil || event.RepoID == -1 {
+			return
+		}
+		if create, ok := payload.(*CreatePayload); !ok || create.RefType != "repository" {
+			return
+		}
+
+		t.mutex.Lock()
+		repo := t.repo(event.RepoID, event.RepoName)
+		repo.Created = earliest(repo.Created, event.Time)
+		t.mutex.Unlock()
+
+	case "ForkEvent":
+		forkID, forkName := ParseForkEvent(event.RepoName, data)
+		if forkID <= 0 {
+			return
+		}
+		t.mutex.Lock()
+		repo := t.repo(forkID, forkName)
+		repo.Created = earliest(repo.Created, event.Time)
+		t.mutex.Unlock()
+
+	case "PublicEvent":
+		if event.RepoID == -1 {
+			return
+		}
+		t.mutex.Lock()
+		repo := t.repo(event.RepoID, event.RepoName)
+		repo.Public = earliest(repo.Public, event.Time)
+		t.mutex.Unlock()
+	}
+}
+
+// Repos returns the lifecycle of every repo seen, sorted by id
+func (t *LifecycleTracker) Repos() []*RepoLifecycle {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	repos := make([]*RepoLifecycle, 0, len(t.repos))
+	for _, repo := range t.repos {
+		repos = append(repos, repo)
+	}
+	sort.Slice(repos, func(i, j int) bool { return repos[i].ID < repos[j].ID })
+	return repos
+}
@@ -0,0 +1,250 @@
+package githubarchive
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OutageFilename is the name of the file in the githubarchive directory that records
+// hours that githubarchive never published
+const OutageFilename = "missing_hours.txt"
+
+// OutageThreshold is the number of different days that an hour has to return a 404 on
+// before it's treated as a known outage
+const OutageThreshold = 3
+
+// OutageMinAge is how old an hour has to be before a 404 for it is recorded, since
+// githubarchive can take a while to publish recent hours
+const OutageMinAge = 48 * time.Hour
+
+// outageKnown marks the learned hours that have reached the OutageThreshold, so that
+// the shell scripts don't need to know the threshold
+const outageKnown = "known"
+
+const outageHeader = `# Hours that githubarchive never published, one per line like 2016-01-01-15.
+# Lines without a count are known outages, so hours can be added by hand. Other
+# lines were learned from 404s, counting at most one per day: 'hour count lastday'
+# until the count reaches %d, and then 'hour known'. Comments are kept when the
+# file is rewritten.
+`
+
+type outage struct {
+	notFound int
+	manual   bool
+	known    bool
+
+	// lastDay is the day that the last 404 was counted on
+	lastDay time.Time
+
+	// comments are the comment and blank lines above the hour in the file
+	comments []string
+}
+
+// OutageCalendar is a persisted record of hours that are permanently missing from
+// githubarchive, so that they can be skipped rather than treated as errors
+type OutageCalendar struct {
+	filename string
+	mutex    sync.Mutex
+	hours    map[time.Time]*outage
+
+	// header and footer are the comments before the first hour and after the last
+	header  []string
+	footer  []string
+	changed bool
+}
+
+// LoadOutageCalendar reads the calendar from filename. A missing file is treated as
+// an empty calendar
+func LoadOutageCalendar(filename string) (*OutageCalendar, error) {
+	calendar := &OutageCalendar{filename: filename, hours: make(map[time.Time]*outage)}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			calendar.header = strings.Split(strings.TrimSuffix(fmt.Sprintf(outageHeader, OutageThreshold), "\n"), "\n")
+			return calendar, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var comments []string
+	seenHour := false
+	scanner := bufio.NewScanner(f)
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			comments = append(comments, line)
+			continue
+		}
+
+		tokens := strings.Fields(line)
+		hour, err := parseArchiveFilename(tokens[0] + ".json.gz")
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse '%s' line %d: %s", filename, lineno, err.Error())
+		}
+
+		entry := &outage{}
+		if len(tokens) == 1 {
+			entry.manual = true
+		} else if tokens[1] == outageKnown {
+			entry.known = true
+		} else {
+			if entry.notFound, err = strconv.Atoi(tokens[1]); err != nil {
+				return nil, fmt.Errorf("Failed to parse '%s' line %d: %s", filename, lineno, err.Error())
+			}
+			if len(tokens) > 2 {
+				if entry.lastDay, err = time.Parse("2006-01-02", tokens[2]); err != nil {
+					return nil, fmt.Errorf("Failed to parse '%s' line %d: %s", filename, lineno, err.Error())
+				}
+			}
+
+			// older files only had the count, rewrite them with the known marker
+			if entry.notFound >= OutageThreshold {
+				entry.known = true
+				calendar.changed = true
+			}
+		}
+
+		if seenHour {
+			entry.comments = comments
+		} else {
+			calendar.header = comments
+			seenHour = true
+		}
+		comments = nil
+		calendar.hours[hour] = entry
+	}
+	if seenHour {
+		calendar.footer = comments
+	} else {
+		calendar.header = comments
+	}
+	return calendar, scanner.Err()
+}
+
+// IsKnownOutage returns whether the hour is known to be missing from githubarchive.
+// This is safe to call on a nil calendar
+func (c *OutageCalendar) IsKnownOutage(hour time.Time) bool {
+	if c == nil {
+		return false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry, ok := c.hours[hour.UTC().Truncate(time.Hour)]
+	return ok && (entry.manual || entry.known)
+}
+
+// RecordNotFound notes that githubarchive returned a 404 for the hour. Hours newer than
+// OutageMinAge are ignored, and only the first 404 for an hour on each day is counted so
+// that an outage isn't learned from the retries of a single run
+func (c *OutageCalendar) RecordNotFound(hour time.Time) {
+	if c == nil {
+		return
+	}
+	now := time.Now().UTC()
+	hour = hour.UTC().Truncate(time.Hour)
+	if now.Sub(hour) < OutageMinAge {
+		return
+	}
+	today := now.Truncate(24 * time.Hour)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	entry, ok := c.hours[hour]
+	if !ok {
+		entry = &outage{lastDay: today}
+		c.hours[hour] = entry
+	} else if entry.manual || entry.known || entry.lastDay.Equal(today) {
+		return
+	}
+	entry.notFound++
+	entry.lastDay = today
+	entry.known = entry.notFound >= OutageThreshold
+	c.changed = true
+}
+
+// KnownOutages returns every hour that is known to be missing, sorted chronologically
+func (c *OutageCalendar) KnownOutages() []time.Time {
+	var hours []time.Time
+	c.mutex.Lock()
+	for hour, entry := range c.hours {
+		if entry.manual || entry.known {
+			hours = append(hours, hour)
+		}
+	}
+	c.mutex.Unlock()
+
+	sort.Slice(hours, func(i, j int) bool { return hours[i].Before(hours[j]) })
+	return hours
+}
+
+// Save writes the calendar back to the file it was loaded from, keeping any comments.
+// Nothing is written if no 404's have been recorded since it was loaded
+func (c *OutageCalendar) Save() error {
+	c.mutex.Lock()
+	if !c.changed {
+		c.mutex.Unlock()
+		return nil
+	}
+	hours := make([]time.Time, 0, len(c.hours))
+	for hour := range c.hours {
+		hours = append(hours, hour)
+	}
+	sort.Slice(hours, func(i, j int) bool { return hours[i].Before(hours[j]) })
+
+	var lines []string
+	lines = append(lines, c.header...)
+	for _, hour := range hours {
+		entry := c.hours[hour]
+		lines = append(lines, entry.comments...)
+
+		name := strings.TrimSuffix(archiveFilename(hour), ".json.gz")
+		if entry.manual {
+			lines = append(lines, name)
+		} else if entry.known {
+			lines = append(lines, name+" "+outageKnown)
+		} else if entry.lastDay.IsZero() {
+			lines = append(lines, fmt.Sprintf("%s %d", name, entry.notFound))
+		} else {
+			lines = append(lines, fmt.Sprintf("%s %d %s", name, entry.notFound, entry.lastDay.Format("2006-01-02")))
+		}
+	}
+	lines = append(lines, c.footer...)
+	c.mutex.Unlock()
+	contents := strings.Join(lines, "\n") + "\n"
+
+	// write to a temporary file first so that a crash doesn't lose hand edited entries
+	f, err := ioutil.TempFile(path.Dir(c.filename), "."+path.Base(c.filename)+".")
+	if err != nil {
+		return err
+	}
+	if err = f.Chmod(0644); err == nil {
+		_, err = f.WriteString(contents)
+	}
+	if err == nil {
+		err = f.Close()
+	} else {
+		f.Close()
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), c.filename)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	c.mutex.Lock()
+	c.changed = false
+	c.mutex.Unlock()
+	return nil
+}
@@ -0,0 +1,106 @@
+package githubarchive
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOutageCalendarKeepsComments(t *testing.T) {
+	basedir, err := ioutil.TempDir("", "githubarchive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(basedir)
+
+	filename := path.Join(basedir, OutageFilename)
+	original := `# my notes about the outages
+2012-01-01-1
+
+# confirmed on the mailing list
+2016-01-01-15 3
+2016-01-02-3 1 2016-03-05
+# trailing comment
+`
+	if err := ioutil.WriteFile(filename, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	calendar, err := LoadOutageCalendar(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for hour, expected := range map[string]bool{"2012-01-01-1": true, "2016-01-01-15": true, "2016-01-02-3": false} {
+		parsed, err := parseArchiveFilename(hour + ".json.gz")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if calendar.IsKnownOutage(parsed) != expected {
+			t.Errorf("Expected IsKnownOutage(%s) to be %t", hour, expected)
+		}
+	}
+
+	// two 404s on the same day only count once
+	missing := time.Date(2016, time.February, 1, 0, 0, 0, 0, time.UTC)
+	calendar.RecordNotFound(missing)
+	calendar.RecordNotFound(missing)
+	if err := calendar.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	today := time.Now().UTC().Format("2006-01-02")
+	expected := `# my notes about the outages
+2012-01-01-1
+
+# confirmed on the mailing list
+2016-01-01-15 known
+2016-01-02-3 1 2016-03-05
+2016-02-01-0 1 ` + today + `
+# trailing comment
+`
+	if string(contents) != expected {
+		t.Errorf("Unexpected contents after saving:\n%s\nexpected:\n%s", contents, expected)
+	}
+}
+
+func TestOutageCalendarSkipsUnchangedSave(t *testing.T) {
+	basedir, err := ioutil.TempDir("", "githubarchive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(basedir)
+
+	filename := path.Join(basedir, OutageFilename)
+	calendar, err := LoadOutageCalendar(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// hours that are too recent aren't recorded, so there's nothing to save
+	calendar.RecordNotFound(time.Now())
+	if err := calendar.Save(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Errorf("Expected an unchanged calendar to not be written")
+	}
+
+	calendar.RecordNotFound(testHour)
+	if err := calendar.Save(); err != nil {
+		t.Fatal(err)
+	}
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(contents), "# Hours that githubarchive never published") {
+		t.Errorf("Expected a new calendar to start with the header, got:\n%s", contents)
+	}
+}
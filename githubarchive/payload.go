@@ -0,0 +1,442 @@
+package githubarchive
+
+import (
+	"fmt"
+
+	"github.com/buger/jsonparser"
+)
+
+// Payload is the typed payload of an event, as returned by ParsePayload. Each payload
+// handles both the timeline format used before 2015, and the events api format used
+// from 2015 onwards
+type Payload interface {
+	EventType() string
+}
+
+// Commit is a single commit pushed in a PushEvent
+type Commit struct {
+	SHA           string
+	AuthorName    string
+	AuthorEmail   string
+	MessageLength int
+
+	// Distinct is set if the commit hadn't been pushed to the repo before
+	Distinct bool
+}
+
+// PushPayload is the payload of a PushEvent
+type PushPayload struct {
+	Ref    string
+	Head   string
+	Before string
+	Size   int64
+
+	// DistinctSize is only available from 2015 onwards, and is -1 before then
+	DistinctSize int64
+	Commits      []Commit
+}
+
+// PullRequestPayload is the payload of a PullRequestEvent. The events from 2011 don't
+// include the head and base repos or the merged flag, and AuthorAssociation is only
+// available from 2017 onwards
+type PullRequestPayload struct {
+	Action string
+	Number int64
+	ID     int64
+	Title  string
+	Merged bool
+
+	// Author is the login of the user that opened the pull request, which can be
+	// different from the actor of the event
+	Author            string
+	AuthorAssociation string
+
+	Commits      int64
+	Additions    int64
+	Deletions    int64
+	ChangedFiles int64
+
+	// HeadRepoID is -1 and HeadRepoName is empty when the head repo was deleted
+	HeadRepoID   int64
+	HeadRepoName string
+	HeadRef      string
+	BaseRepoID   int64
+	BaseRepoName string
+	BaseRef      string
+}
+
+// IsCrossRepo returns if the pull request was made from a different repo than the one
+// it's merging into, like a fork. A missing head repo along with a base repo means that
+// the fork was deleted, which is also treated as cross repo
+func (p *PullRequestPayload) IsCrossRepo() bool {
+	hasHead := p.HeadRepoID != -1 || p.HeadRepoName != ""
+	hasBase := p.BaseRepoID != -1 || p.BaseRepoName != ""
+	if !hasHead {
+		return hasBase
+	}
+	if p.HeadRepoID != -1 && p.BaseRepoID != -1 {
+		return p.HeadRepoID != p.BaseRepoID
+	}
+	return p.HeadRepoName != "" && p.BaseRepoName != "" && p.HeadRepoName != p.BaseRepoName
+}
+
+// IssuesPayload is the payload of an IssuesEvent
+type IssuesPayload struct {
+	Action  string
+	Number  int64
+	IssueID int64
+	Title   string
+}
+
+// IssueCommentPayload is the payload of an IssueCommentEvent
+type IssueCommentPayload struct {
+	Action    string
+	IssueID   int64
+	CommentID int64
+
+	// Number is only available from 2015 onwards, and is -1 before then
+	Number int64
+}
+
+// WatchPayload is the payload of a WatchEvent
+type WatchPayload struct {
+	Action string
+}
+
+// CreatePayload is the payload of a CreateEvent
+type CreatePayload struct {
+	Ref          string
+	RefType      string
+	MasterBranch string
+	Description  string
+}
+
+// DeletePayload is the payload of a DeleteEvent
+type DeletePayload struct {
+	Ref     string
+	RefType string
+}
+
+// ReleasePayload is the payload of a ReleaseEvent
+type ReleasePayload struct {
+	Action     string
+	ID         int64
+	TagName    string
+	Name       string
+	Draft      bool
+	Prerelease bool
+}
+
+// MemberPayload is the payload of a MemberEvent
+type MemberPayload struct {
+	Action string
+	// MemberID is -1 for the early events that only recorded the login
+	MemberID   int64
+	MemberName string
+}
+
+// WikiPage is a single page changed in a GollumEvent
+type WikiPage struct {
+	PageName string
+	Title    string
+	Action   string
+	SHA      string
+}
+
+// GollumPayload is the payload of a GollumEvent
+type GollumPayload struct {
+	Pages []WikiPage
+}
+
+// EventType returns the type of event the payload is from
+func (p *PushPayload) EventType() string { return "PushEvent" }
+
+// EventType returns the type of event the payload is from
+func (p *PullRequestPayload) EventType() string { return "PullRequestEvent" }
+
+// EventType returns the type of event the payload is from
+func (p *IssuesPayload) EventType() string { return "IssuesEvent" }
+
+// EventType returns the type of event the payload is from
+func (p *IssueCommentPayload) EventType() string { return "IssueCommentEvent" }
+
+// EventType returns the type of event the payload is from
+func (p *WatchPayload) EventType() string { return "WatchEvent" }
+
+// EventType returns the type of event the payload is from
+func (p *CreatePayload) EventType() string { return "CreateEvent" }
+
+// EventType returns the type of event the payload is from
+func (p *DeletePayload) EventType() string { return "DeleteEvent" }
+
+// EventType returns the type of event the payload is from
+func (p *ReleasePayload) EventType() string { return "ReleaseEvent" }
+
+// EventType returns the type of event the payload is from
+func (p *MemberPayload) EventType() string { return "MemberEvent" }
+
+// EventType returns the type of event the payload is from
+func (p *GollumPayload) EventType() string { return "GollumEvent" }
+
+// ParsePayload parses the payload of a JSON githubarchive event into the typed payload
+// for its event type. Returns an error for event types without a typed payload
+func ParsePayload(data []byte) (Payload, error) {
+	eventType, err := jsonparser.GetString(data, "type")
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get event type: %s", err.Error())
+	}
+
+	payload, err := getPayload(data, eventType)
+	if err != nil {
+		return nil, err
+	}
+
+	switch eventType {
+	case "PushEvent":
+		return parsePushPayload(payload)
+	case "PullRequestEvent":
+		return parsePullRequestPayload(payload), nil
+	case "IssuesEvent":
+		return parseIssuesPayload(payload), nil
+	case "IssueCommentEvent":
+		return parseIssueCommentPayload(payload), nil
+	case "WatchEvent":
+		action, _ := jsonparser.GetString(payload, "action")
+		return &WatchPayload{Action: action}, nil
+	case "CreateEvent":
+		p := &CreatePayload{}
+		p.Ref, p.RefType = parseRef(payload)
+		p.MasterBranch, _ = jsonparser.GetString(payload, "master_branch")
+		p.Description, _ = jsonparser.GetString(payload, "description")
+		return p, nil
+	case "DeleteEvent":
+		p := &DeletePayload{}
+		p.Ref, p.RefType = parseRef(payload)
+		return p, nil
+	case "ReleaseEvent":
+		return parseReleasePayload(payload), nil
+	case "MemberEvent":
+		return parseMemberPayload(payload), nil
+	case "GollumEvent":
+		return parseGollumPayload(payload), nil
+	}
+	return nil, fmt.Errorf("Unsupported event type '%s'", eventType)
+}
+
+// getPayload returns the payload object of an event, checking that the event has the
+// expected type
+func getPayload(data []byte, eventType string) ([]byte, error) {
+	if actual, _ := jsonparser.GetString(data, "type"); actual != eventType {
+		return nil, fmt.Errorf("Failed to parse payload: expected '%s', got '%s'", eventType, actual)
+	}
+
+	payload, dataType, _, err := jsonparser.Get(data, "payload")
+	if err != nil || dataType != jsonparser.Object {
+		return nil, fmt.Errorf("Failed to get payload for '%s'", eventType)
+	}
+	return payload, nil
+}
+
+// getInt returns an integer from the JSON, or -1 if it's missing
+func getInt(data []byte, keys ...string) int64 {
+	value, err := jsonparser.GetInt(data, keys...)
+	if err != nil {
+		return -1
+	}
+	return value
+}
+
+// ParsePushEvent parses the payload of a JSON PushEvent, including the commits from
+// both the commits list used from 2015 onwards and the shas arrays used before then
+func ParsePushEvent(data []byte) (*PushPayload, error) {
+	payload, err := getPayload(data, "PushEvent")
+	if err != nil {
+		return nil, err
+	}
+	return parsePushPayload(payload)
+}
+
+func parsePushPayload(payload []byte) (*PushPayload, error) {
+	p := &PushPayload{Size: getInt(payload, "size"), DistinctSize: getInt(payload, "distinct_size")}
+	p.Ref, _ = jsonparser.GetString(payload, "ref")
+	p.Head, _ = jsonparser.GetString(payload, "head")
+	p.Before, _ = jsonparser.GetString(payload, "before")
+
+	_, err := jsonparser.ArrayEach(payload, func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
+		// skip malformed entries rather than counting them as empty commits
+		if dataType != jsonparser.Object {
+			return
+		}
+		commit := Commit{}
+		commit.SHA, _ = jsonparser.GetString(value, "sha")
+		commit.AuthorName, _ = jsonparser.GetString(value, "author", "name")
+		commit.AuthorEmail, _ = jsonparser.GetString(value, "author", "email")
+		commit.Distinct, _ = jsonparser.GetBoolean(value, "distinct")
+		message, _ := jsonparser.GetString(value, "message")
+		commit.MessageLength = len(message)
+		p.Commits = append(p.Commits, commit)
+	}, "commits")
+	if err != nil && err != jsonparser.KeyPathNotFoundError {
+		return nil, fmt.Errorf("Failed to parse push commits: %s", err.Error())
+	}
+
+	// before 2015 commits were stored as [sha, email, message, name, distinct] arrays
+	_, err = jsonparser.ArrayEach(payload, func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
+		if dataType != jsonparser.Array {
+			return
+		}
+		commit := Commit{}
+		commit.SHA, _ = jsonparser.GetString(value, "[0]")
+		commit.AuthorEmail, _ = jsonparser.GetString(value, "[1]")
+		commit.AuthorName, _ = jsonparser.GetString(value, "[3]")
+		message, _ := jsonparser.GetString(value, "[2]")
+		commit.MessageLength = len(message)
+
+		// the earliest events don't have the distinct flag, so count their commits as distinct
+		distinct, err := jsonparser.GetBoolean(value, "[4]")
+		commit.Distinct = distinct || err != nil
+		p.Commits = append(p.Commits, commit)
+	}, "shas")
+	if err != nil && err != jsonparser.KeyPathNotFoundError {
+		return nil, fmt.Errorf("Failed to parse push shas: %s", err.Error())
+	}
+
+	return p, nil
+}
+
+// ParsePullRequestEvent parses the payload of a JSON PullRequestEvent
+func ParsePullRequestEvent(data []byte) (*PullRequestPayload, error) {
+	payload, err := getPayload(data, "PullRequestEvent")
+	if err != nil {
+		return nil, err
+	}
+	return parsePullRequestPayload(payload), nil
+}
+
+func parsePullRequestPayload(payload []byte) *PullRequestPayload {
+	p := &PullRequestPayload{Number: getInt(payload, "number"), ID: getInt(payload, "pull_request", "id")}
+	if p.Number == -1 {
+		p.Number = getInt(payload, "pull_request", "number")
+	}
+	p.Action, _ = jsonparser.GetString(payload, "action")
+	p.Title, _ = jsonparser.GetString(payload, "pull_request", "title")
+	p.Merged, _ = jsonparser.GetBoolean(payload, "pull_request", "merged")
+	p.Author, _ = jsonparser.GetString(payload, "pull_request", "user", "login")
+	p.AuthorAssociation, _ = jsonparser.GetString(payload, "pull_request", "author_association")
+
+	p.Commits = getInt(payload, "pull_request", "commits")
+	p.Additions = getInt(payload, "pull_request", "additions")
+	p.Deletions = getInt(payload, "pull_request", "deletions")
+	p.ChangedFiles = getInt(payload, "pull_request", "changed_files")
+
+	p.HeadRepoID, p.HeadRepoName, p.HeadRef = parsePullRequestBranch(payload, "head")
+	p.BaseRepoID, p.BaseRepoName, p.BaseRef = parsePullRequestBranch(payload, "base")
+	return p
+}
+
+// parsePullRequestBranch returns the repo id, repo name and ref of the head or base of a
+// pull request. Before full_name was added to the api the name has to be built up from
+// the owner, and the repo is missing entirely when the head fork has been deleted
+func parsePullRequestBranch(payload []byte, branch string) (int64, string, string) {
+	ref, _ := jsonparser.GetString(payload, "pull_request", branch, "ref")
+	repoID := getInt(payload, "pull_request", branch, "repo", "id")
+
+	name, err := jsonparser.GetString(payload, "pull_request", branch, "repo", "full_name")
+	if err != nil {
+		owner, ownerErr := jsonparser.GetString(payload, "pull_request", branch, "repo", "owner", "login")
+		repo, repoErr := jsonparser.GetString(payload, "pull_request", branch, "repo", "name")
+		if ownerErr == nil && repoErr == nil {
+			name = owner + "/" + repo
+		}
+	}
+	return repoID, name, ref
+}
+
+func parseIssuesPayload(payload []byte) *IssuesPayload {
+	p := &IssuesPayload{Number: getInt(payload, "number"), IssueID: getInt(payload, "issue")}
+	p.Action, _ = jsonparser.GetString(payload, "action")
+
+	// before 2015 the issue was just the id, afterwards it's the full issue object
+	if p.IssueID == -1 {
+		p.IssueID = getInt(payload, "issue", "id")
+		p.Number = getInt(payload, "issue", "number")
+		p.Title, _ = jsonparser.GetString(payload, "issue", "title")
+	}
+	return p
+}
+
+func parseIssueCommentPayload(payload []byte) *IssueCommentPayload {
+	p := &IssueCommentPayload{IssueID: getInt(payload, "issue_id"), CommentID: getInt(payload, "comment_id"), Number: -1}
+	p.Action, _ = jsonparser.GetString(payload, "action")
+	if p.IssueID == -1 {
+		p.IssueID = getInt(payload, "issue", "id")
+		p.CommentID = getInt(payload, "comment", "id")
+		p.Number = getInt(payload, "issue", "number")
+	}
+
+	// timeline comments didn't have an action, since they could only be created
+	if p.Action == "" {
+		p.Action = "created"
+	}
+	return p
+}
+
+// parseRef returns the ref and ref_type of a Create or Delete event, which were stored
+// as object_name and object in the earliest events
+func parseRef(payload []byte) (string, string) {
+	ref, err := jsonparser.GetString(payload, "ref")
+	if err != nil {
+		ref, _ = jsonparser.GetString(payload, "object_name")
+	}
+	refType, err := jsonparser.GetString(payload, "ref_type")
+	if err != nil {
+		refType, _ = jsonparser.GetString(payload, "object")
+	}
+	return ref, refType
+}
+
+func parseReleasePayload(payload []byte) *ReleasePayload {
+	p := &ReleasePayload{ID: getInt(payload, "release", "id")}
+	p.Action, _ = jsonparser.GetString(payload, "action")
+	p.TagName, _ = jsonparser.GetString(payload, "release", "tag_name")
+	p.Name, _ = jsonparser.GetString(payload, "release", "name")
+	p.Draft, _ = jsonparser.GetBoolean(payload, "release", "draft")
+	p.Prerelease, _ = jsonparser.GetBoolean(payload, "release", "prerelease")
+	return p
+}
+
+func parseMemberPayload(payload []byte) *MemberPayload {
+	p := &MemberPayload{MemberID: getInt(payload, "member", "id")}
+	p.Action, _ = jsonparser.GetString(payload, "action")
+
+	name, err := jsonparser.GetString(payload, "member", "login")
+	if err != nil {
+		name, _ = jsonparser.GetString(payload, "member")
+	}
+	p.MemberName = name
+	return p
+}
+
+func parseGollumPayload(payload []byte) *GollumPayload {
+	p := &GollumPayload{}
+	parsePage := func(value []byte) WikiPage {
+		page := WikiPage{}
+		page.PageName, _ = jsonparser.GetString(value, "page_name")
+		page.Title, _ = jsonparser.GetString(value, "title")
+		page.Action, _ = jsonparser.GetString(value, "action")
+		page.SHA, _ = jsonparser.GetString(value, "sha")
+		return page
+	}
+
+	jsonparser.ArrayEach(payload, func(value []byte, dataType jsonparser.ValueType, offset int, err error) {
+		p.Pages = append(p.Pages, parsePage(value))
+	}, "pages")
+
+	// the earliest events only had a single page, stored directly in the payload
+	if len(p.Pages) == 0 {
+		if _, err := jsonparser.GetString(payload, "page_name"); err == nil {
+			p.Pages = append(p.Pages, parsePage(payload))
+		}
+	}
+	return p
+}
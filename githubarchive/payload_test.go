@@ -0,0 +1,94 @@
+package githubarchive
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestIsCrossRepo(t *testing.T) {
+	tests := []struct {
+		name     string
+		payload  PullRequestPayload
+		expected bool
+	}{
+		{"same repo", PullRequestPayload{HeadRepoID: 1, HeadRepoName: "a/b", BaseRepoID: 1, BaseRepoName: "a/b"}, false},
+		{"fork", PullRequestPayload{HeadRepoID: 2, HeadRepoName: "c/b", BaseRepoID: 1, BaseRepoName: "a/b"}, true},
+		{"fork without ids", PullRequestPayload{HeadRepoID: -1, HeadRepoName: "c/b", BaseRepoID: -1, BaseRepoName: "a/b"}, true},
+		{"deleted fork", PullRequestPayload{HeadRepoID: -1, BaseRepoID: 1, BaseRepoName: "a/b"}, true},
+		{"no repos", PullRequestPayload{HeadRepoID: -1, BaseRepoID: -1}, false},
+	}
+	for _, test := range tests {
+		if crossRepo := test.payload.IsCrossRepo(); crossRepo != test.expected {
+			t.Errorf("IsCrossRepo for '%s' returned %t, expected %t", test.name, crossRepo, test.expected)
+		}
+	}
+}
+
+func TestParseGoldenPayloads(t *testing.T) {
+	payloads := 0
+	for filename, golden := range loadGoldenEvents(t) {
+		if golden.Payload == nil {
+			continue
+		}
+		payloads++
+
+		payload, err := ParsePayload(golden.Event)
+		if err != nil {
+			t.Errorf("Failed to parse payload for '%s': %s", filename, err.Error())
+			continue
+		}
+
+		// the expected payload is unmarshalled into the same type that ParsePayload returned,
+		// so a payload of the wrong type fails on the event type below
+		expected := reflect.New(reflect.TypeOf(payload).Elem()).Interface().(Payload)
+		if err := json.Unmarshal(golden.Payload, expected); err != nil {
+			t.Fatalf("Failed to parse expected payload for '%s': %s", filename, err.Error())
+		}
+		if payload.EventType() != golden.Expected.Type || !reflect.DeepEqual(payload, expected) {
+			t.Errorf("Parsing payload of '%s'\ngot:      %+v\nexpected: %+v", filename, payload, expected)
+		}
+	}
+	if payloads == 0 {
+		t.Error("No golden payloads found in testdata")
+	}
+}
+
+func TestParsePushEvent(t *testing.T) {
+	tests := []struct {
+		name     string
+		payload  string
+		expected []Commit
+	}{
+		{"shas", `{"shas":[["6dcb09b5","octocat@github.com","Fix all the bugs","The Octocat",false]]}`,
+			[]Commit{{SHA: "6dcb09b5", AuthorName: "The Octocat", AuthorEmail: "octocat@github.com", MessageLength: 16}}},
+		{"shas without distinct", `{"shas":[["6dcb09b5","octocat@github.com","Fix","The Octocat"]]}`,
+			[]Commit{{SHA: "6dcb09b5", AuthorName: "The Octocat", AuthorEmail: "octocat@github.com", MessageLength: 3, Distinct: true}}},
+		{"commits", `{"commits":[{"sha":"6dcb09b5","author":{"email":"octocat@github.com","name":"The Octocat"},"message":"Fix","distinct":true},` +
+			`{"sha":"7e8f9012","author":{"email":"hubot@github.com","name":"Hubot"},"message":"Merge","distinct":false}]}`,
+			[]Commit{{SHA: "6dcb09b5", AuthorName: "The Octocat", AuthorEmail: "octocat@github.com", MessageLength: 3, Distinct: true},
+				{SHA: "7e8f9012", AuthorName: "Hubot", AuthorEmail: "hubot@github.com", MessageLength: 5}}},
+		{"non object commit", `{"commits":["6dcb09b5",{"sha":"7e8f9012","distinct":true}]}`,
+			[]Commit{{SHA: "7e8f9012", Distinct: true}}},
+		{"non array sha", `{"shas":["6dcb09b5",["7e8f9012"]]}`,
+			[]Commit{{SHA: "7e8f9012", Distinct: true}}},
+		{"no commits", `{"size":0}`, nil},
+	}
+	for _, test := range tests {
+		push, err := ParsePushEvent([]byte(`{"type":"PushEvent","payload":` + test.payload + `}`))
+		if err != nil {
+			t.Errorf("Failed to parse '%s': %s", test.name, err.Error())
+			continue
+		}
+		if !reflect.DeepEqual(push.Commits, test.expected) {
+			t.Errorf("Parsing commits for '%s'\ngot:      %+v\nexpected: %+v", test.name, push.Commits, test.expected)
+		}
+	}
+
+	if _, err := ParsePushEvent([]byte(`{"type":"PushEvent","payload":{"commits":{"sha":"6dcb09b5"}}}`)); err == nil {
+		t.Error("Expected an error when commits isn't an array")
+	}
+	if _, err := ParsePushEvent([]byte(`{"type":"WatchEvent","payload":{}}`)); err == nil {
+		t.Error("Expected an error parsing a WatchEvent as a PushEvent")
+	}
+}
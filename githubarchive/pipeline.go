@@ -0,0 +1,230 @@
+package githubarchive
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"os"
+	"runtime"
+	"sync"
+)
+
+// pipelineBatchSize is the number of lines handed to a parsing worker at a time
+const pipelineBatchSize = 1024
+
+type lineBatch struct {
+	seq    int
+	lines  [][]byte
+	events []*Event
+}
+
+// PipelineScanner scans over the contents of a githubarchive file like Scanner, but
+// decompresses on one goroutine and parses batches of lines on a pool of workers. Events
+// are parsed once by the workers, so Event doesn't reparse the JSON on each call.
+//
+// This doesn't support Lenient, Filter or Line/Offset like Scanner does, and isn't used
+// by the gha-parse commands: they already process a day per CPU, so parsing each file
+// in parallel as well wouldn't make them any faster. It's meant for tools that read a
+// single large file, where Scanner is limited to one core
+type PipelineScanner struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	closers []io.Closer
+	ordered bool
+
+	results chan *lineBatch
+	readErr error
+
+	pending map[int]*lineBatch
+	nextSeq int
+	batch   *lineBatch
+	index   int
+	lastErr error
+}
+
+// NewPipelineScanner opens filename and creates a new pipelined scanner from its
+// contents. workers is the number of parsing goroutines (defaulting to the number of
+// CPUs when <= 0). When ordered is false events are returned in whatever order the
+// batches finish parsing, which is faster when the order of events doesn't matter
+func NewPipelineScanner(ctx context.Context, filename string, workers int, ordered bool) (*PipelineScanner, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	it, err := NewReaderPipelineScanner(ctx, f, workers, ordered)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	it.closers = append([]io.Closer{f}, it.closers...)
+	return it, nil
+}
+
+// NewReaderPipelineScanner creates a new pipelined scanner reading newline delimited JSON
+// from r, detecting the compression the same way as NewReaderScanner. Closing the scanner
+// doesn't close r
+func NewReaderPipelineScanner(ctx context.Context, r io.Reader, workers int, ordered bool) (*PipelineScanner, error) {
+	reader, closer, err := decompress(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	it := &PipelineScanner{
+		ctx:     ctx,
+		cancel:  cancel,
+		ordered: ordered,
+		results: make(chan *lineBatch, workers),
+		pending: make(map[int]*lineBatch),
+		index:   -1,
+	}
+	if closer != nil {
+		it.closers = append(it.closers, closer)
+	}
+
+	batches := make(chan *lineBatch, workers)
+	go it.read(reader, batches)
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			it.parse(batches)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(it.results)
+	}()
+	return it, nil
+}
+
+// read splits the decompressed stream into batches of lines
+func (it *PipelineScanner) read(reader io.Reader, batches chan<- *lineBatch) {
+	defer close(batches)
+
+	buf := bufio.NewReaderSize(reader, 4*1024*1024)
+	batch := &lineBatch{lines: make([][]byte, 0, pipelineBatchSize)}
+	for {
+		line, err := buf.ReadBytes('\n')
+		if len(line) > 0 {
+			batch.lines = append(batch.lines, line)
+		}
+
+		if len(batch.lines) == pipelineBatchSize || (err != nil && len(batch.lines) > 0) {
+			select {
+			case batches <- batch:
+			case <-it.ctx.Done():
+				return
+			}
+			batch = &lineBatch{seq: batch.seq + 1, lines: make([][]byte, 0, pipelineBatchSize)}
+		}
+
+		if err != nil {
+			if err != io.EOF {
+				it.readErr = err
+			}
+			return
+		}
+	}
+}
+
+// parse runs ParseEvent over each line in the batches
+func (it *PipelineScanner) parse(batches <-chan *lineBatch) {
+	for batch := range batches {
+		batch.events = make([]*Event, len(batch.lines))
+		for i, line := range batch.lines {
+			batch.events[i] = ParseEvent(line)
+		}
+
+		select {
+		case it.results <- batch:
+		case <-it.ctx.Done():
+			return
+		}
+	}
+}
+
+// nextBatch returns the next parsed batch, waiting for batches that finish out of
+// order when the scanner is ordered
+func (it *PipelineScanner) nextBatch() (*lineBatch, bool) {
+	if !it.ordered {
+		batch, ok := <-it.results
+		return batch, ok
+	}
+
+	for {
+		if batch, ok := it.pending[it.nextSeq]; ok {
+			delete(it.pending, it.nextSeq)
+			it.nextSeq++
+			return batch, true
+		}
+
+		batch, ok := <-it.results
+		if !ok {
+			return nil, false
+		}
+		it.pending[batch.seq] = batch
+	}
+}
+
+// Bytes returns the current line as a byte array
+func (it *PipelineScanner) Bytes() []byte {
+	return it.batch.lines[it.index]
+}
+
+// Event returns the current Event, which has already been parsed by a worker
+func (it *PipelineScanner) Event() *Event {
+	return it.batch.events[it.index]
+}
+
+// Scan for the next entry. Returns false at the end of the file or on error, with the
+// error available from Err
+func (it *PipelineScanner) Scan() bool {
+	for {
+		if err := it.ctx.Err(); err != nil {
+			it.lastErr = err
+			return false
+		}
+
+		if it.batch != nil && it.index+1 < len(it.batch.lines) {
+			it.index++
+			return true
+		}
+
+		batch, ok := it.nextBatch()
+		if !ok {
+			// the results channel is only closed once the reader has finished
+			it.lastErr = it.readErr
+			if it.lastErr == nil {
+				it.lastErr = it.ctx.Err()
+			}
+			return false
+		}
+		it.batch, it.index = batch, -1
+	}
+}
+
+// Err returns the last error seen in scan
+func (it *PipelineScanner) Err() error {
+	return it.lastErr
+}
+
+// Close stops the pipeline and closes the scanner
+func (it *PipelineScanner) Close() {
+	it.cancel()
+
+	// wait for the reader and workers to exit before closing the decompressor
+	for range it.results {
+	}
+
+	for i := len(it.closers) - 1; i >= 0; i-- {
+		it.closers[i].Close()
+	}
+}
@@ -0,0 +1,157 @@
+package githubarchive
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// benchmarkHour generates a gzipped hour of push events, roughly the size of a busy hour
+func benchmarkHour(b testing.TB) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	for i := 0; i < 20000; i++ {
+		fmt.Fprintf(w, `{"id":"%d","type":"PushEvent","actor":{"id":%d,"login":"user%d"},`+
+			`"repo":{"id":%d,"name":"user%d/repo%d"},"payload":{"push_id":%d,"size":1,"distinct_size":1,`+
+			`"ref":"refs/heads/master","commits":[{"sha":"%040d","author":{"email":"user%d@example.com","name":"User %d"},`+
+			`"message":"Commit %d","distinct":true}]},"public":true,"created_at":"2016-01-01T15:%02d:%02dZ"}`+"\n",
+			i, i%1000, i%1000, i%5000, i%1000, i%5000, i, i, i%1000, i%1000, i, (i/60)%60, i%60)
+	}
+	if err := w.Close(); err != nil {
+		b.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func BenchmarkScanner(b *testing.B) {
+	data := benchmarkHour(b)
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		it, err := NewReaderScanner(bytes.NewReader(data))
+		if err != nil {
+			b.Fatal(err)
+		}
+		for it.Scan() {
+			it.Event()
+		}
+		if err := it.Err(); err != nil {
+			b.Fatal(err)
+		}
+		it.Close()
+	}
+}
+
+func benchmarkPipelineScanner(b *testing.B, ordered bool) {
+	data := benchmarkHour(b)
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		it, err := NewReaderPipelineScanner(context.Background(), bytes.NewReader(data), 0, ordered)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for it.Scan() {
+			it.Event()
+		}
+		if err := it.Err(); err != nil {
+			b.Fatal(err)
+		}
+		it.Close()
+	}
+}
+
+func BenchmarkPipelineScanner(b *testing.B) {
+	b.Run("ordered", func(b *testing.B) { benchmarkPipelineScanner(b, true) })
+	b.Run("unordered", func(b *testing.B) { benchmarkPipelineScanner(b, false) })
+}
+
+func TestPipelineScannerOrdered(t *testing.T) {
+	data := benchmarkHour(t)
+
+	expected, err := NewReaderScanner(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer expected.Close()
+
+	it, err := NewReaderPipelineScanner(context.Background(), bytes.NewReader(data), 4, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+
+	lines := 0
+	for expected.Scan() {
+		if !it.Scan() {
+			t.Fatalf("Pipeline stopped after %d lines: %v", lines, it.Err())
+		}
+		lines++
+		if !bytes.Equal(expected.Bytes(), it.Bytes()) || !reflect.DeepEqual(expected.Event(), it.Event()) {
+			t.Fatalf("Line %d differs: expected %+v, got %+v", lines, expected.Event(), it.Event())
+		}
+	}
+	if it.Scan() {
+		t.Errorf("Pipeline returned more than the %d lines from the scanner", lines)
+	}
+	if err := it.Err(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPipelineScannerCloseBeforeEOF(t *testing.T) {
+	data := benchmarkHour(t)
+	goroutines := runtime.NumGoroutine()
+
+	it, err := NewReaderPipelineScanner(context.Background(), bytes.NewReader(data), 4, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !it.Scan() {
+		t.Fatal(it.Err())
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		it.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close deadlocked before the end of the file")
+	}
+
+	// the reader and workers exit asynchronously after the results are drained
+	for deadline := time.Now().Add(5 * time.Second); runtime.NumGoroutine() > goroutines; {
+		if time.Now().After(deadline) {
+			t.Fatalf("Leaked %d goroutines after Close", runtime.NumGoroutine()-goroutines)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPipelineScannerReadError(t *testing.T) {
+	data := benchmarkHour(t)
+
+	it, err := NewReaderPipelineScanner(context.Background(), bytes.NewReader(data[:len(data)/2]), 4, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer it.Close()
+
+	lines := 0
+	for it.Scan() {
+		lines++
+	}
+	if it.Err() == nil {
+		t.Errorf("Expected an error reading a truncated file, got %d lines and no error", lines)
+	}
+}
@@ -0,0 +1,161 @@
+package githubarchive
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"time"
+)
+
+// RangeScanner scans over the events in every hour file in a time range, opening
+// the hours in chronological order and closing each one as soon as it's finished
+type RangeScanner struct {
+	// Lenient scans each hour file in lenient mode, and skips over hour files that
+	// can't be opened. The damage is available from Damaged
+	Lenient bool
+
+	// Filter restricts the events returned by Scan, when set
+	Filter *Filter
+
+	ctx     context.Context
+	basedir string
+	layout  Layout
+	hours   []time.Time
+	missing []time.Time
+
+	current     *Scanner
+	currentHour time.Time
+	lastErr     error
+	damaged     []DamagedHour
+}
+
+// DamagedHour records what was skipped when leniently scanning an hour file
+type DamagedHour struct {
+	Hour     time.Time
+	Filename string
+	ScanStats
+}
+
+// NewRangeScanner returns a scanner over every event in the hours [start, end) stored
+// in basedir. Hours that don't have a file are skipped, and are available from Missing
+func NewRangeScanner(ctx context.Context, basedir string, layout Layout, start time.Time, end time.Time) (*RangeScanner, error) {
+	it := &RangeScanner{ctx: ctx, basedir: basedir, layout: layout}
+
+	files := make(dirCache)
+	for hour := start.UTC().Truncate(time.Hour); hour.Before(end); hour = hour.Add(time.Hour) {
+		file, err := files.stat(path.Join(basedir, layout.HourPath(hour)))
+		if err != nil {
+			return nil, err
+		}
+		if file != nil {
+			it.hours = append(it.hours, hour)
+		} else {
+			it.missing = append(it.missing, hour)
+		}
+	}
+	return it, nil
+}
+
+// Hours returns the hours that have files, and will be scanned
+func (it *RangeScanner) Hours() []time.Time {
+	return it.hours
+}
+
+// Missing returns the hours in the range that don't have a file
+func (it *RangeScanner) Missing() []time.Time {
+	return it.missing
+}
+
+// Scan advances to the next event, moving on to the next hour file when the current
+// one is finished. Returns false at the end of the range or on error
+func (it *RangeScanner) Scan() bool {
+	for {
+		if it.current != nil {
+			if it.current.Scan() {
+				return true
+			}
+
+			err := it.current.Err()
+			if stats := it.current.Stats(); stats.Damaged() {
+				it.damaged = append(it.damaged, DamagedHour{it.currentHour, it.currentFilename(), stats})
+			}
+			it.current.Close()
+			it.current = nil
+			if err != nil {
+				if err == it.ctx.Err() {
+					it.lastErr = err
+				} else {
+					it.lastErr = fmt.Errorf("Failed to read '%s': %s", it.currentFilename(), err.Error())
+				}
+				return false
+			}
+		}
+
+		if len(it.hours) == 0 {
+			return false
+		}
+
+		it.currentHour, it.hours = it.hours[0], it.hours[1:]
+		current, err := NewScannerContext(it.ctx, it.currentFilename())
+		if err != nil && it.Lenient {
+			it.damaged = append(it.damaged, DamagedHour{it.currentHour, it.currentFilename(), ScanStats{ReadErr: err}})
+			continue
+		} else if err != nil {
+			it.lastErr = fmt.Errorf("Failed to open '%s': %s", it.currentFilename(), err.Error())
+			return false
+		}
+		current.Lenient = it.Lenient
+		current.Filter = it.Filter
+		it.current = current
+	}
+}
+
+func (it *RangeScanner) currentFilename() string {
+	return path.Join(it.basedir, it.layout.HourPath(it.currentHour))
+}
+
+// Damaged returns the hour files that had data skipped in lenient mode, for the
+// hours that have been scanned so far
+func (it *RangeScanner) Damaged() []DamagedHour {
+	return it.damaged
+}
+
+// Hour returns the hour of the file that the current event came from
+func (it *RangeScanner) Hour() time.Time {
+	return it.currentHour
+}
+
+// Line returns the line number of the current event in its hour file
+func (it *RangeScanner) Line() int {
+	return it.current.Line()
+}
+
+// Offset returns the uncompressed byte offset of the current event in its hour file
+func (it *RangeScanner) Offset() int64 {
+	return it.current.Offset()
+}
+
+// Bytes returns the current line as a byte array
+func (it *RangeScanner) Bytes() []byte {
+	return it.current.Bytes()
+}
+
+// Event returns the current Event, with the Hour set to the file it came from
+func (it *RangeScanner) Event() *Event {
+	event := it.current.Event()
+	event.Hour = it.currentHour
+	return event
+}
+
+// Err returns the last error seen in scan
+func (it *RangeScanner) Err() error {
+	return it.lastErr
+}
+
+// Close the scanner, closing the current hour file if there is one open
+func (it *RangeScanner) Close() {
+	if it.current != nil {
+		it.current.Close()
+		it.current = nil
+	}
+}
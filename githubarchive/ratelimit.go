@@ -0,0 +1,67 @@
+package githubarchive
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// RateLimiter limits the combined bandwidth of every reader that it wraps, so that
+// concurrent downloads don't saturate a shared network link
+type RateLimiter struct {
+	bytesPerSecond int64
+
+	mutex sync.Mutex
+	next  time.Time
+}
+
+// NewRateLimiter returns a RateLimiter allowing bytesPerSecond across all readers.
+// Returns nil (meaning no limit) if bytesPerSecond isn't positive
+func NewRateLimiter(bytesPerSecond int64) *RateLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return &RateLimiter{bytesPerSecond: bytesPerSecond}
+}
+
+// wait blocks until reading n more bytes would stay under the limit
+func (l *RateLimiter) wait(n int) {
+	l.mutex.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(time.Duration(int64(n) * int64(time.Second) / l.bytesPerSecond))
+	l.mutex.Unlock()
+
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// ReadCloser wraps r so that reads from it count against the limit. This is safe
+// to call on a nil RateLimiter, in which case r is returned unchanged
+func (l *RateLimiter) ReadCloser(r io.ReadCloser) io.ReadCloser {
+	if l == nil {
+		return r
+	}
+	return &limitedReader{r, l}
+}
+
+type limitedReader struct {
+	io.ReadCloser
+	limiter *RateLimiter
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	// read in small chunks so that the limit is applied smoothly
+	if len(p) > 32*1024 {
+		p = p[:32*1024]
+	}
+	n, err := r.ReadCloser.Read(p)
+	if n > 0 {
+		r.limiter.wait(n)
+	}
+	return n, err
+}
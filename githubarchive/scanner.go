@@ -2,19 +2,54 @@ package githubarchive
 
 import (
 	"bufio"
+	"bytes"
+	"compress/bzip2"
 	"compress/gzip"
+	"context"
+	"encoding/json"
 	"io"
-
 	"os"
+
+	"github.com/klauspost/compress/zstd"
 )
 
+// ScanStats counts what a lenient Scanner skipped over in a file
+type ScanStats struct {
+	SkippedLines int
+	SkippedBytes int64
+
+	// ReadErr is the error that ended a truncated or corrupt stream early
+	ReadErr error
+}
+
+// Damaged returns if anything in the file was skipped
+func (s ScanStats) Damaged() bool {
+	return s.SkippedLines > 0 || s.ReadErr != nil
+}
+
 // Scanner scans over the contents of a githubarchive File
 type Scanner struct {
-	f       *os.File
-	gr      *gzip.Reader
+	// Lenient skips lines that aren't valid JSON, and treats a read error (like a
+	// truncated gzip stream) as the end of the file instead of failing. What was
+	// skipped is available from Stats
+	Lenient bool
+
+	// Filter restricts the lines returned by Scan, when set
+	Filter *Filter
+
+	ctx     context.Context
+	closers []io.Closer
 	buf     *bufio.Reader
 	bytes   []byte
+	event   *Event
 	lastErr error
+	stats   ScanStats
+
+	// position of the current line, and of the next line to be read
+	line       int
+	offset     int64
+	nextLine   int
+	nextOffset int64
 }
 
 // Bytes returns the current line as a byte array
@@ -22,8 +57,22 @@ func (it *Scanner) Bytes() []byte {
 	return it.bytes
 }
 
+// Line returns the 1-based line number of the current entry in the uncompressed file
+func (it *Scanner) Line() int {
+	return it.line
+}
+
+// Offset returns the byte offset of the start of the current entry in the uncompressed
+// file, which can be passed to ReadEventAt
+func (it *Scanner) Offset() int64 {
+	return it.offset
+}
+
 // Event returns the current Event, parsing the line from JSON
 func (it *Scanner) Event() *Event {
+	if it.event != nil {
+		return it.event
+	}
 	return ParseEvent(it.bytes)
 }
 
@@ -32,16 +81,72 @@ func (it *Scanner) Event() *Event {
 // the the raw version. On error this function returns false, and the
 // error object is available on the Err member
 func (it *Scanner) Scan() bool {
-	bytes, err := it.buf.ReadBytes('\n')
+	if err := it.ctx.Err(); err != nil {
+		it.lastErr = err
+		return false
+	}
 
-	if err != nil {
-		if err != io.EOF {
-			it.lastErr = err
+	for {
+		bytes, err := it.buf.ReadBytes('\n')
+		it.line, it.offset = it.nextLine+1, it.nextOffset
+		it.nextLine++
+		it.nextOffset += int64(len(bytes))
+
+		if err != nil && err != io.EOF && it.Lenient {
+			// keep everything before the corruption, but drop the partial line
+			it.stats.ReadErr = err
+			it.skip(bytes)
+			return false
 		}
-		return false
+
+		if err != nil {
+			// handle the last line not ending in a newline
+			if err == io.EOF && len(bytes) > 0 && it.valid(bytes) && it.matches(bytes) {
+				it.bytes = bytes
+				return true
+			}
+			if err != io.EOF {
+				it.lastErr = err
+			}
+			return false
+		}
+
+		if it.valid(bytes) && it.matches(bytes) {
+			it.bytes = bytes
+			return true
+		}
+	}
+}
+
+// valid returns if the line should be returned from Scan, counting the line as
+// skipped if not
+func (it *Scanner) valid(line []byte) bool {
+	if !it.Lenient || json.Valid(line) {
+		return true
+	}
+	it.skip(line)
+	return false
+}
+
+// matches returns if the line passes the filter, keeping the event if the filter had
+// to parse it so that Event doesn't parse it again
+func (it *Scanner) matches(line []byte) bool {
+	matched, event := it.Filter.match(line)
+	it.event = event
+	return matched
+}
+
+func (it *Scanner) skip(line []byte) {
+	if len(bytes.TrimSpace(line)) == 0 {
+		return
 	}
-	it.bytes = bytes
-	return true
+	it.stats.SkippedLines++
+	it.stats.SkippedBytes += int64(len(line))
+}
+
+// Stats returns what has been skipped so far in lenient mode
+func (it *Scanner) Stats() ScanStats {
+	return it.stats
 }
 
 // Err returns the last error seen in scan
@@ -51,22 +156,88 @@ func (it *Scanner) Err() error {
 
 // Close the scanner
 func (it *Scanner) Close() {
-	it.f.Close()
-	it.gr.Close()
+	for i := len(it.closers) - 1; i >= 0; i-- {
+		it.closers[i].Close()
+	}
 }
 
 // NewScanner open filename and creates a new scanner from its contents
 func NewScanner(filename string) (*Scanner, error) {
+	return NewScannerContext(context.Background(), filename)
+}
+
+// NewScannerContext is like NewScanner, but Scan stops returning entries once ctx is
+// cancelled, with the context's error available from Err
+func NewScannerContext(ctx context.Context, filename string) (*Scanner, error) {
 	f, err := os.Open(filename)
 	if err != nil {
 		return nil, err
 	}
 
-	gr, err := gzip.NewReader(f)
+	it, err := NewReaderScannerContext(ctx, f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	it.closers = append([]io.Closer{f}, it.closers...)
+	return it, nil
+}
+
+// NewReaderScanner creates a new scanner reading newline delimited JSON from r. The
+// compression is detected from the start of the stream, and can be gzip, zstd, bzip2
+// or uncompressed. Closing the scanner doesn't close r
+func NewReaderScanner(r io.Reader) (*Scanner, error) {
+	return NewReaderScannerContext(context.Background(), r)
+}
+
+// NewReaderScannerContext is like NewReaderScanner, but Scan stops returning entries
+// once ctx is cancelled
+func NewReaderScannerContext(ctx context.Context, r io.Reader) (*Scanner, error) {
+	reader, closer, err := decompress(r)
 	if err != nil {
 		return nil, err
 	}
 
-	buf := bufio.NewReaderSize(gr, 20*1024*1024)
-	return &Scanner{f: f, gr: gr, buf: buf}, nil
+	it := &Scanner{ctx: ctx, buf: bufio.NewReaderSize(reader, 20*1024*1024)}
+	if closer != nil {
+		it.closers = append(it.closers, closer)
+	}
+	return it, nil
+}
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	bzip2Magic = []byte("BZh")
+)
+
+// decompress detects the compression used by r, returning a reader for the
+// uncompressed contents and an optional closer for the decompressor
+func decompress(r io.Reader) (io.Reader, io.Closer, error) {
+	br := bufio.NewReader(r)
+	header, err := br.Peek(4)
+	if err != nil && err != io.EOF {
+		return nil, nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(header, gzipMagic):
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, nil, err
+		}
+		return gr, gr, nil
+
+	case bytes.HasPrefix(header, zstdMagic):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, nil, err
+		}
+		rc := zr.IOReadCloser()
+		return rc, rc, nil
+
+	case bytes.HasPrefix(header, bzip2Magic):
+		return bzip2.NewReader(br), nil, nil
+	}
+	return br, nil, nil
 }
@@ -0,0 +1,302 @@
+package githubarchive
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultArchiveURL is the location of the public githubarchive files
+const DefaultArchiveURL = "http://data.githubarchive.org"
+
+// ArchiveSource provides the gzipped contents of githubarchive files for each hour
+type ArchiveSource interface {
+	// Open returns the gzipped contents of the file for an hour. If the hour doesn't
+	// exist on the source, the error returned satisfies IsNotFound. Reading from the
+	// contents fails once ctx is cancelled
+	Open(ctx context.Context, hour time.Time) (io.ReadCloser, error)
+
+	// Location describes where the file for an hour comes from, for logging
+	Location(hour time.Time) string
+}
+
+// notFoundError is returned by sources that don't have a file for an hour
+type notFoundError struct {
+	location string
+}
+
+func (e *notFoundError) Error() string {
+	return fmt.Sprintf("'%s' not found", e.location)
+}
+
+// IsNotFound returns whether an error means that the source doesn't have the hour
+func IsNotFound(err error) bool {
+	switch e := err.(type) {
+	case *notFoundError:
+		return true
+	case *statusError:
+		return e.statusCode == http.StatusNotFound
+	}
+	return false
+}
+
+// archiveFilename returns the name that githubarchive uses for an hour (like 2015-01-01-15.json.gz)
+func archiveFilename(hour time.Time) string {
+	return fmt.Sprintf("%04d-%02d-%02d-%d.json.gz", hour.Year(), hour.Month(), hour.Day(), hour.Hour())
+}
+
+// parseArchiveFilename returns the hour for a githubarchive filename like 2015-01-01-15.json.gz
+func parseArchiveFilename(name string) (time.Time, error) {
+	tokens := strings.Split(strings.TrimSuffix(name, ".json.gz"), "-")
+	if len(tokens) != 4 || !strings.HasSuffix(name, ".json.gz") {
+		return time.Time{}, fmt.Errorf("Invalid githubarchive filename '%s'", name)
+	}
+
+	var values [4]int
+	for i, token := range tokens {
+		value, err := strconv.Atoi(token)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("Invalid githubarchive filename '%s'", name)
+		}
+		values[i] = value
+	}
+
+	hour := time.Date(values[0], time.Month(values[1]), values[2], values[3], 0, 0, 0, time.UTC)
+	if archiveFilename(hour) != name {
+		return time.Time{}, fmt.Errorf("Invalid githubarchive filename '%s'", name)
+	}
+	return hour, nil
+}
+
+// FileVersion identifies a version of a githubarchive file, for conditional requests
+type FileVersion struct {
+	ETag    string
+	ModTime time.Time
+}
+
+// ErrNotModified is returned by ConditionalSource when the file hasn't changed
+var ErrNotModified = errors.New("githubarchive: file not modified")
+
+// ConditionalSource is implemented by sources that can tell if a file has been
+// regenerated since it was last downloaded
+type ConditionalSource interface {
+	ArchiveSource
+
+	// OpenIfModified returns the contents for an hour and its version, unless the
+	// file matches the version passed in, in which case ErrNotModified is returned.
+	// A zero version always fetches the file
+	OpenIfModified(ctx context.Context, hour time.Time, version FileVersion) (io.ReadCloser, FileVersion, error)
+}
+
+// DefaultUserAgent identifies this project to the githubarchive servers
+const DefaultUserAgent = "github-analysis (https://github.com/benfred/github-analysis)"
+
+// NewHTTPClient returns a http.Client with timeouts suitable for downloading
+// githubarchive files. The timeout covers the entire request, including reading the
+// body, so should be set generously when the bandwidth is limited
+func NewHTTPClient(timeout time.Duration) *http.Client {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 60 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+		MaxIdleConnsPerHost:   16,
+		// files are already gzipped, and we want to store them that way
+		DisableCompression: true,
+	}
+	return &http.Client{Transport: transport, Timeout: timeout}
+}
+
+// HTTPSource fetches githubarchive files from a web server
+type HTTPSource struct {
+	BaseURL   string
+	Client    *http.Client
+	UserAgent string
+
+	// Limiter restricts the bandwidth used by downloads, can be nil for no limit
+	Limiter *RateLimiter
+}
+
+// NewHTTPSource returns a source that fetches files from baseURL, using the default
+// githubarchive url if baseURL is empty
+func NewHTTPSource(baseURL string) *HTTPSource {
+	if baseURL == "" {
+		baseURL = DefaultArchiveURL
+	}
+	return &HTTPSource{BaseURL: strings.TrimSuffix(baseURL, "/"), Client: NewHTTPClient(30 * time.Minute),
+		UserAgent: DefaultUserAgent}
+}
+
+// Location returns the url for the hour
+func (s *HTTPSource) Location(hour time.Time) string {
+	return s.BaseURL + "/" + archiveFilename(hour)
+}
+
+// Open fetches the hour from the web server
+func (s *HTTPSource) Open(ctx context.Context, hour time.Time) (io.ReadCloser, error) {
+	contents, _, err := s.OpenIfModified(ctx, hour, FileVersion{})
+	return contents, err
+}
+
+// OpenIfModified fetches the hour from the web server, using the If-None-Match and
+// If-Modified-Since headers to avoid downloading files that haven't changed
+func (s *HTTPSource) OpenIfModified(ctx context.Context, hour time.Time, version FileVersion) (io.ReadCloser, FileVersion, error) {
+	url := s.Location(hour)
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, FileVersion{}, err
+	}
+	req = req.WithContext(ctx)
+	if s.UserAgent != "" {
+		req.Header.Set("User-Agent", s.UserAgent)
+	}
+	if version.ETag != "" {
+		req.Header.Set("If-None-Match", version.ETag)
+	}
+	if !version.ModTime.IsZero() {
+		req.Header.Set("If-Modified-Since", version.ModTime.UTC().Format(http.TimeFormat))
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return nil, FileVersion{}, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		return nil, version, ErrNotModified
+	}
+
+	if resp.StatusCode != 200 {
+		resp.Body.Close()
+		return nil, FileVersion{}, &statusError{url: url, status: resp.Status, statusCode: resp.StatusCode}
+	}
+
+	current := FileVersion{ETag: resp.Header.Get("ETag")}
+	current.ModTime, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	return s.Limiter.ReadCloser(resp.Body), current, nil
+}
+
+// DirSource reads githubarchive files from a local directory or network mount
+type DirSource struct {
+	Path   string
+	Layout Layout
+}
+
+// NewDirSource returns a source reading files from pathname, which is expected to mirror
+// the githubarchive naming (like /mnt/mirror/2015-01-01-15.json.gz)
+func NewDirSource(pathname string) *DirSource {
+	return &DirSource{Path: pathname, Layout: FlatLayout}
+}
+
+// Location returns the filename for the hour
+func (s *DirSource) Location(hour time.Time) string {
+	return path.Join(s.Path, s.Layout.HourPath(hour))
+}
+
+// Open opens the file for the hour
+func (s *DirSource) Open(ctx context.Context, hour time.Time) (io.ReadCloser, error) {
+	filename := s.Location(hour)
+	f, err := os.Open(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, &notFoundError{filename}
+		}
+		return nil, err
+	}
+	return newContextReader(ctx, f), nil
+}
+
+// MemorySource holds githubarchive files in memory. This is mainly useful for
+// testing, either directly or served over http with NewSourceHandler
+type MemorySource struct {
+	mutex sync.RWMutex
+	files map[time.Time][]byte
+}
+
+// NewMemorySource returns an empty MemorySource
+func NewMemorySource() *MemorySource {
+	return &MemorySource{files: make(map[time.Time][]byte)}
+}
+
+// Add stores the gzipped contents for an hour
+func (s *MemorySource) Add(hour time.Time, contents []byte) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.files[hour.UTC().Truncate(time.Hour)] = contents
+}
+
+// Location returns a name for the hour
+func (s *MemorySource) Location(hour time.Time) string {
+	return "memory:" + archiveFilename(hour)
+}
+
+// Open returns the contents stored for the hour
+func (s *MemorySource) Open(ctx context.Context, hour time.Time) (io.ReadCloser, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	contents, ok := s.files[hour.UTC().Truncate(time.Hour)]
+	if !ok {
+		return nil, &notFoundError{s.Location(hour)}
+	}
+	return newContextReader(ctx, ioutil.NopCloser(bytes.NewReader(contents))), nil
+}
+
+// NewSourceHandler returns a http.Handler that serves files from source using the
+// githubarchive naming scheme. Combined with httptest.NewServer and a HTTPSource this
+// lets the download code be exercised without network access
+func NewSourceHandler(source ArchiveSource) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hour, err := parseArchiveFilename(path.Base(r.URL.Path))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+
+		contents, err := source.Open(r.Context(), hour)
+		if err != nil {
+			if IsNotFound(err) {
+				http.NotFound(w, r)
+			} else {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+		defer contents.Close()
+
+		w.Header().Set("Content-Type", "application/gzip")
+		io.Copy(w, contents)
+	})
+}
+
+// contextReader fails reads once its context has been cancelled
+type contextReader struct {
+	io.ReadCloser
+	ctx context.Context
+}
+
+func newContextReader(ctx context.Context, r io.ReadCloser) io.ReadCloser {
+	return &contextReader{r, ctx}
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.ReadCloser.Read(p)
+}
@@ -1,13 +1,22 @@
 package githubarchive
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
 	"path"
+	"strings"
+	"time"
 )
 
-// FindDayPaths returns the locations of all day like things in a subdir hierarchy
+// FindDayPaths returns the locations of all day like things in a subdir hierarchy.
+// This only works with the NestedLayout, see FindDays for other layouts
 func FindDayPaths(pathname string) ([]string, error) {
+	return FindDayPathsContext(context.Background(), pathname)
+}
+
+// FindDayPathsContext is like FindDayPaths, but gives up when ctx is cancelled
+func FindDayPathsContext(ctx context.Context, pathname string) ([]string, error) {
 	results := []string{}
 
 	years, err := ioutil.ReadDir(pathname)
@@ -15,6 +24,9 @@ func FindDayPaths(pathname string) ([]string, error) {
 		return nil, fmt.Errorf("Failed to open '%s': %s", pathname, err.Error())
 	}
 	for _, year := range years {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
 		if year.IsDir() {
 			yearpath := path.Join(pathname, year.Name())
 			months, err := ioutil.ReadDir(yearpath)
@@ -23,6 +35,9 @@ func FindDayPaths(pathname string) ([]string, error) {
 			}
 
 			for _, month := range months {
+				if err := ctx.Err(); err != nil {
+					return nil, err
+				}
 				if month.IsDir() {
 					monthpath := path.Join(yearpath, month.Name())
 					days, err := ioutil.ReadDir(monthpath)
@@ -41,3 +56,16 @@ func FindDayPaths(pathname string) ([]string, error) {
 	}
 	return results, nil
 }
+
+// ParseDayPath returns the day that a path returned from FindDayPaths refers to
+func ParseDayPath(daypath string) (time.Time, error) {
+	tokens := strings.Split(path.Clean(daypath), "/")
+	if len(tokens) < 3 {
+		return time.Time{}, fmt.Errorf("Failed to parse day from '%s'", daypath)
+	}
+	day, err := time.Parse("2006/01/02", strings.Join(tokens[len(tokens)-3:], "/"))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Failed to parse day from '%s': %s", daypath, err.Error())
+	}
+	return day, nil
+}
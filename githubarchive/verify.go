@@ -0,0 +1,157 @@
+package githubarchive
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// VerifyAction controls what happens to corrupt files found by Verify
+type VerifyAction int
+
+const (
+	// VerifyReport only reports corrupt files, leaving them in place
+	VerifyReport VerifyAction = iota
+	// VerifyQuarantine renames corrupt files with a '.corrupt' suffix so that they are
+	// no longer picked up by the analysis
+	VerifyQuarantine
+	// VerifyRedownload quarantines corrupt files and then downloads them again
+	VerifyRedownload
+)
+
+// ParseVerifyAction converts a string like 'quarantine' into a VerifyAction
+func ParseVerifyAction(name string) (VerifyAction, error) {
+	switch name {
+	case "report":
+		return VerifyReport, nil
+	case "quarantine":
+		return VerifyQuarantine, nil
+	case "redownload":
+		return VerifyRedownload, nil
+	}
+	return VerifyReport, fmt.Errorf("Unknown verify action '%s'", name)
+}
+
+// VerifySummary lists the results of verifying the githubarchive files on disk
+type VerifySummary struct {
+	Checked      int
+	Corrupt      []FailedHour
+	Redownloaded []time.Time
+	Failed       []FailedHour
+}
+
+// Err returns an error if any corrupt files couldn't be fixed
+func (s *VerifySummary) Err() error {
+	if len(s.Failed) > 0 {
+		return fmt.Errorf("Failed to fix %d corrupt hours", len(s.Failed))
+	}
+	return nil
+}
+
+// Print writes out a human readable version of the summary
+func (s *VerifySummary) Print(w io.Writer) {
+	fmt.Fprintf(w, "Checked %d hours, %d corrupt, %d redownloaded, %d failed\n",
+		s.Checked, len(s.Corrupt), len(s.Redownloaded), len(s.Failed))
+	for _, corrupt := range s.Corrupt {
+		fmt.Fprintf(w, "  corrupt %s: %s\n", corrupt.Hour.Format(hourFormat), corrupt.Err.Error())
+	}
+	for _, failed := range s.Failed {
+		fmt.Fprintf(w, "  failed %s: %s\n", failed.Hour.Format(hourFormat), failed.Err.Error())
+	}
+}
+
+// Verify checks that every githubarchive file in the BaseDir is a complete gzip
+// stream, and handles any corrupt or truncated files according to action
+func (d *Downloader) Verify(action VerifyAction) (*VerifySummary, error) {
+	return d.VerifyContext(context.Background(), action)
+}
+
+// VerifyContext is like Verify, but stops checking files when ctx is cancelled
+func (d *Downloader) VerifyContext(ctx context.Context, action VerifyAction) (*VerifySummary, error) {
+	allHours, err := ListHours(ctx, d.BaseDir, d.Layout)
+	if err != nil {
+		return nil, err
+	}
+
+	workers := d.Workers
+	if workers < 1 {
+		workers = 1
+	}
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	summary := &VerifySummary{}
+
+	hours := make(chan time.Time, 100)
+
+	worker := func() {
+		defer wg.Done()
+		for hour := range hours {
+			err := validateGzipContext(ctx, d.hourPath(hour))
+			if ctx.Err() != nil {
+				continue
+			}
+
+			mutex.Lock()
+			summary.Checked++
+			if err != nil {
+				summary.Corrupt = append(summary.Corrupt, FailedHour{hour, err})
+			}
+			mutex.Unlock()
+
+			if err == nil || action == VerifyReport {
+				continue
+			}
+
+			err = d.fixCorruptHour(ctx, hour, action)
+
+			mutex.Lock()
+			if err != nil {
+				summary.Failed = append(summary.Failed, FailedHour{hour, err})
+			} else if action == VerifyRedownload {
+				summary.Redownloaded = append(summary.Redownloaded, hour)
+			}
+			mutex.Unlock()
+		}
+	}
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go worker()
+	}
+
+Loop:
+	for _, hour := range allHours {
+		select {
+		case <-ctx.Done():
+			break Loop
+		case hours <- hour:
+		}
+	}
+	close(hours)
+	wg.Wait()
+
+	return summary, ctx.Err()
+}
+
+func (d *Downloader) fixCorruptHour(ctx context.Context, hour time.Time, action VerifyAction) error {
+	filename := d.hourPath(hour)
+	if d.DryRun {
+		fmt.Fprintf(os.Stderr, "dry-run: quarantining '%s'\n", filename)
+		return nil
+	}
+
+	if err := os.Rename(filename, filename+".corrupt"); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Quarantined '%s'\n", filename)
+
+	if action == VerifyRedownload {
+		_, _, err := d.downloadWithRetries(ctx, hour, nil)
+		return err
+	}
+	return nil
+}
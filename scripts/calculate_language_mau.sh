@@ -13,16 +13,37 @@ fi
 
 export LC_COLLATE=C
 
+# leave out the accounts flagged as bots by gha-classify-bots, if it's been run
+bots=/dev/null
+if [ -f $1/bots.tsv ] ; then
+    bots=$1/bots.tsv
+fi
+
 for year in $1/*/; do
     echo "processing year: $year"
     for month in $year*/; do
         echo "   processing month $month"
 
+        # check that every hour of the month was downloaded, ignoring hours that githubarchive
+        # never published (known outages in missing_hours.txt, see gha-download-files)
+        prefix=$(basename $year)-$(basename $month)-
+        days=$(date -d "$(basename $year)-$(basename $month)-01 +1 month -1 day" +%d)
+        known=0
+        if [ -f $1/missing_hours.txt ] ; then
+            known=$(awk -v prefix=$prefix '!/^#/ && index($1, prefix) == 1 && (NF == 1 || $2 == "known")' $1/missing_hours.txt | wc -l)
+        fi
+        present=$(ls $month*/*.json.gz 2>/dev/null | wc -l)
+        expected=$((10#$days * 24 - known))
+        echo "$present $expected $known" > $month/coverage.txt
+        if [ $present -lt $expected ] ; then
+            echo "   WARNING: $month only has $present of $expected hours ($known known outages)"
+        fi
+
         # figure out the number of MAU in the month
-        time awk -F $'\t' '{print $6}' $month*/parsed_events.tsv  | sort -u -S 80% | wc -l > $month/mau.txt
+        time awk -F $'\t' -v bots=$bots 'FILENAME == bots {skip[$1] = 1; next} !($6 in skip) {print $6}' $bots $month*/parsed_events.tsv  | sort -u -S 80% | wc -l > $month/mau.txt
 
         # extract tuples of repoid/reponame/repolanguage/userid from the events, and sort/dedupe them
-        time awk -F $'\t' '{print $2 "\t" $3 "\t" $4 "\t" $6}' $month*/parsed_events.tsv | sort -u -S 80% > $month/repo_user.tsv
+        time awk -F $'\t' -v bots=$bots 'FILENAME == bots {skip[$1] = 1; next} !($6 in skip) {print $2 "\t" $3 "\t" $4 "\t" $6}' $bots $month*/parsed_events.tsv | sort -u -S 80% > $month/repo_user.tsv
 
         # join this file agains the larger list of repo languages passed as a parameter
         time join -t $'\t' -a 1 -e Missing -o 1.3,2.3,1.4 -1 1 -2 1 $month/repo_user.tsv $1/repo_languages.tsv |
@@ -20,9 +20,12 @@ echo "Getting repo languages from Postgres"
 psql github -c "COPY (select id, name, COALESCE(language, 'None') from repos WHERE statuscode = 200 OR language is not null) TO STDOUT WITH NULL AS ''" | sort -S 80% > crawled_languages.tsv
 
 # Generate a map of repoid/reponame/usercount from the extracted GitHubArchive events: needed to lookup repoid for GHTorrent project
-# which doesn't include this (just the reponame)
+# which doesn't include this (just the reponame). This uses every name that each repo has had, so that renamed
+# repos still get matched. This also writes parsed_events_resolved.tsv files, with the repo ids filled in for the
+# events that only had a name
 echo "Looking up repoid for GHTorrent data"
-find -name parsed_events.tsv | xargs awk -F $'\t' '{print $3 "\t" $2}' | sort -u -S 80% | grep -v '\-1$' > repoids.tsv
+gha-resolve-identities -path .
+awk -F $'\t' '{print $2 "\t" $1}' repo_identities.tsv | sort -u -S 80% > repoids.tsv
 
 # get repoid/reponame/language from ghtorrents, by joining with the repoids.tsv
 sort -S 80% ghtorrents_reponame_language.tsv > ghtorrents_reponame_language_sorted.tsv
@@ -36,7 +39,7 @@ time join -t $'\t' -a 1 -a 2 -e Missing -o 0,1.2,2.2,1.3,2.3 -1 1 -2 1 crawled_l
 
 # join the output of that with the fork file analysis, preferring previous if given
 echo "Analyzing GithubArchive for Fork Events"
-find -name parsed_events.tsv | xargs grep "^ForkEvent" | awk -F $'\t' '{print $2 "\t" $3 "\t" $7 "\t" $8}' | sort -u -S 80% | grep -v '^\-1' > forkevents.tsv
+find -name parsed_events_resolved.tsv | xargs grep "^ForkEvent" | awk -F $'\t' '{print $2 "\t" $3 "\t" $7 "\t" $8}' | sort -u -S 80% | grep -v '^\-1' > forkevents.tsv
 
 echo "Getting language for fork events"
 join -t $'\t' -1 1 -2 1 -o 1.3,1.4,2.3 forkevents.tsv temp_language.tsv | grep -Ev '^(-1|0|\s)' | sort -S 80% > fork_languages.tsv
@@ -48,7 +51,7 @@ time join -t $'\t' -a 1 -a 2 -e Missing -o 0,1.2,2.2,1.3,2.3 -1 1 -2 1 temp_lang
 
 # Get language from parsed json events (only works from 2012-2015), and PR events on 2015+
 echo "Analyzing GithubArchive for embedded language information"
-find -name parsed_events.tsv | xargs awk -F $'\t' '{print $2 "\t" $3 "\t" $4}' | grep -v $'\t$' | sort -u -S 80% > githubarchive_language.tsv
+find -name parsed_events_resolved.tsv | xargs awk -F $'\t' '{print $2 "\t" $3 "\t" $4}' | grep -v $'\t$' | sort -u -S 80% > githubarchive_language.tsv
 
 # Finally join that again with main language map to get the final repoid/reponame/language mapping
 echo "Joining extracted GitHub language info with main language map"